@@ -2,34 +2,23 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 
-	_ "modernc.org/sqlite"
-
-	"github.com/RobertMNewton/gozam/internal/database"
+	"github.com/RobertMNewton/gozam/pkg/catalog"
 	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+	"github.com/go-audio/audio"
 	"github.com/go-audio/wav"
 )
 
-var ddl string = `
-CREATE TABLE IF NOT EXISTS songs (
-    id INTEGER PRIMARY KEY,
-    name text NOT NULL
-);
-
-CREATE TABLE IF NOT EXISTS song_hashes (
-    id INTEGER PRIMARY KEY,
-    song_id INTEGER NOT NULL,
-    song_hash INTEGER NOT NULL,
-
-    FOREIGN KEY (song_id) REFERENCES songs (id)
-);
-`
+// CHUNK_SIZE is the number of sample frames read from a wav file at a time when streaming it
+const CHUNK_SIZE = 1 << 16
 
 var songs = map[string]string{
 	"Baby Shark Dance":                              "XqZsoesa55w",
@@ -47,33 +36,67 @@ var songs = map[string]string{
 	"I'm on a Boat by The Lonely Island ft. T-Pain": "2zNSgSzhBfM",
 }
 
-const (
-	BIN_SIZE           int = 44800 / 10
-	OVERLAP            int = 44800 / 4 / 10
-	HASH_TOP_N         int = 1000
-	MAX_TOKEN_TIME_DFF int = 25
-)
-
 func main() {
+	algorithm := flag.String("algo", "windowed", fmt.Sprintf("fingerprint algorithm (%s)", strings.Join(fingerprint.Algorithms(), ", ")))
+	configName := flag.String("config", "default", fmt.Sprintf("fingerprint config preset (%s) or JSON/YAML file", strings.Join(fingerprint.Presets(), ", ")))
+	chromaConfigName := flag.String("chroma", "", "also store beat chroma for cover search, computed with this config preset or file (e.g. chroma)")
+	flag.Parse()
+
 	ctx := context.Background()
 
-	db, err := sql.Open("sqlite", "data/gozam.db")
+	cfg, err := fingerprint.ResolveConfig(*configName)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	fingerprinter, err := fingerprint.New(*algorithm, cfg)
+	if err != nil {
+		log.Fatalf("failed to create fingerprinter: %v", err)
+	}
+
+	cat, err := catalog.Open(ctx, "data/gozam.db")
 	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+		log.Fatalf("failed to open catalog: %v", err)
 	}
+	defer cat.Close()
 
-	if _, err := db.ExecContext(ctx, ddl); err != nil {
-		log.Fatalf("failed to create to tables in database: %v", err)
+	if err := cat.SetInfo(ctx, fingerprinter); err != nil {
+		log.Fatalf("failed to write catalog info: %v", err)
 	}
 
-	queries := database.New(db)
+	var chromaCfg *fingerprint.Config
+	if *chromaConfigName != "" {
+		cfg, err := fingerprint.ResolveConfig(*chromaConfigName)
+		if err != nil {
+			log.Fatalf("failed to load chroma config: %v", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			log.Fatalf("invalid chroma config: %v", err)
+		}
+		chromaCfg = &cfg
+	}
 
 	for songName, ytID := range songs {
-		songID, err := queries.InsertSong(ctx, songName)
+		songID, err := cat.AddSong(ctx, songName)
 		if err != nil {
 			log.Fatalf("failed to insert song '%s' into db: %v", songName, err)
 		}
 
+		if chromaCfg != nil {
+			if err := addChroma(ctx, cat, songID, songName, ytID, *chromaCfg); err != nil {
+				log.Fatalf("failed to compute chroma of song '%s': %v", songName, err)
+			}
+		}
+
+		fingerprinted, err := cat.HasFingerprint(ctx, *algorithm, songID)
+		if err != nil {
+			log.Fatalf("failed to read song '%s' from db: %v", songName, err)
+		}
+		if fingerprinted {
+			fmt.Printf("song %s already hashed with %s\n", songName, *algorithm)
+			continue
+		}
+
 		filepath := fmt.Sprintf("data/tmp/%s", ytID)
 		if !fileExists(filepath) {
 			saveYoutubeAudio(ytID, filepath)
@@ -86,23 +109,103 @@ func main() {
 		}
 
 		decoder := wav.NewDecoder(reader)
+
+		fmt.Printf("hashing song %s... \n", songName)
+		err = fingerprintWav(decoder, fingerprinter, func(songFingerprint fingerprint.Fingerprint) error {
+			return cat.AddFingerprint(ctx, *algorithm, songID, songFingerprint)
+		})
+		if errors.Is(err, fingerprint.ErrAudioTooShort) {
+			fmt.Printf("Error fingerprinting '%s': %v\n", songName, err)
+			continue
+		} else if err != nil {
+			log.Fatalf("failed to fingerprint file '%s': %v", filepath, err)
+		}
+	}
+}
+
+// addChroma stores the beat chroma of the song for cover search, unless it already has it. Songs
+// too short to track beats in are skipped.
+func addChroma(ctx context.Context, cat *catalog.SQLite, songID int64, songName, ytID string, cfg fingerprint.Config) error {
+	has, err := cat.HasChroma(ctx, songID)
+	if err != nil || has {
+		return err
+	}
+
+	reader, err := decodeWebMAudioToPCMReader(ytID)
+	if err != nil {
+		fmt.Printf("Error decoding audio for '%s': %v\n", ytID, err)
+		return nil
+	}
+
+	buff, err := wav.NewDecoder(reader).FullPCMBuffer()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("computing chroma of song %s... \n", songName)
+	beatChroma, err := fingerprint.GetBeatChroma(buff, cfg)
+	if errors.Is(err, fingerprint.ErrAudioTooShort) {
+		fmt.Printf("Error computing chroma of '%s': %v\n", songName, err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return cat.AddChroma(ctx, songID, cfg, beatChroma)
+}
+
+// fingerprintWav fingerprints the decoded audio, passing the fingerprint to insert. Fingerprinters
+// that can stream are fed a chunk of the file at a time so long files don't have to fit in memory,
+// and insert is called as each part of the fingerprint completes.
+func fingerprintWav(decoder *wav.Decoder, fingerprinter fingerprint.Fingerprinter, insert func(fingerprint.Fingerprint) error) error {
+	streamer, ok := fingerprinter.(fingerprint.StreamFingerprinter)
+	if !ok {
 		buff, err := decoder.FullPCMBuffer()
 		if err != nil {
-			log.Fatalf("failed to decode file '%s': %v", filepath, err)
+			return err
 		}
 
-		fmt.Printf("hashing song %s... \n", songName)
-		songFingerprint := fingerprint.GetFingerPrint2(buff, BIN_SIZE, OVERLAP, HASH_TOP_N, MAX_TOKEN_TIME_DFF, 3)
-		for hash := range songFingerprint.Hashes {
-			err := queries.InsertSongHash(ctx, database.InsertSongHashParams{
-				SongID:   songID,
-				SongHash: int64(hash),
-			})
-			if err != nil {
-				log.Fatalf("failed to insert song hash: %v", err)
-			}
+		songFingerprint, err := fingerprinter.Fingerprint(buff)
+		if err != nil {
+			return err
 		}
+		return insert(songFingerprint)
+	}
+
+	if err := decoder.FwdToPCM(); err != nil {
+		return err
+	}
+
+	format := decoder.Format()
+	stream, err := streamer.NewStream(*format)
+	if err != nil {
+		return err
+	}
+
+	chunk := &audio.IntBuffer{Format: format, Data: make([]int, CHUNK_SIZE*format.NumChannels)}
+	for {
+		n, err := decoder.PCMBuffer(chunk)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+
+		part, err := stream.Write(chunk.AsFloatBuffer().Data[:n])
+		if err != nil {
+			return err
+		}
+		if err := insert(part); err != nil {
+			return err
+		}
+	}
+
+	part, err := stream.Flush()
+	if err != nil {
+		return err
 	}
+	return insert(part)
 }
 
 func fileExists(filename string) bool {
@@ -2,106 +2,264 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/signal"
-	"sort"
+	"strings"
+	"time"
 
-	_ "modernc.org/sqlite"
-
-	"github.com/RobertMNewton/gozam/internal/database"
+	"github.com/RobertMNewton/gozam/pkg/catalog"
 	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+	"github.com/RobertMNewton/gozam/pkg/recognizer"
 	"github.com/go-audio/audio"
 	"github.com/go-audio/wav"
 	"github.com/gordonklaus/portaudio"
 )
 
 const (
-	BIN_SIZE           int = 44800 / 10
-	OVERLAP            int = 44800 / 4 / 10
-	HASH_TOP_N         int = 1000
-	MAX_TOKEN_TIME_DFF int = 25
-	SAMPLE_RATE        int = 44800 // Standard audio sample rate
-	BUFFER_SIZE        int = 4096  // Buffer size for capturing audio
-	DURATION           int = 10    // Record for 10 seconds
+	BUFFER_SIZE   int = 4096 // Buffer size for capturing audio
+	DURATION      int = 10   // Record for at most 10 seconds
+	MATCHES_SHOWN int = 3    // Number of candidate songs printed
 )
 
 func main() {
+	algorithm := flag.String("algo", "", fmt.Sprintf("fingerprint algorithm (%s), defaults to the catalog's", strings.Join(fingerprint.Algorithms(), ", ")))
+	configName := flag.String("config", "", fmt.Sprintf("fingerprint config preset (%s) or JSON/YAML file, defaults to the catalog's", strings.Join(fingerprint.Presets(), ", ")))
+	duration := flag.Int("duration", DURATION, "maximum number of seconds to listen for")
+	threshold := flag.Float64("confidence", recognizer.DefaultOptions.Threshold, "confidence a match needs to be reported, and to answer early")
+	scoreMargin := flag.Float64("margin", recognizer.DefaultOptions.Margin, "how many times the runner up's score the top song needs before answering early")
+	tolerance := flag.Int64("tolerance", 0, "also match hashes whose time delta is within this many frames, for algorithms hashing pairs of peaks")
+	speed := flag.Float64("speed", 0.05, "also match songs played up to this fraction faster or slower, 0 to disable")
+	cover := flag.Bool("cover", false, "search for songs the recording is a cover or live version of, by beat chroma")
+	coverThreshold := flag.Float64("cover-threshold", recognizer.DefaultCoverOptions.Threshold, "score a cover needs to be reported")
+	flag.Parse()
+
 	ctx := context.Background()
 
 	// Connect to database
-	db, err := sql.Open("sqlite", "data/gozam.db")
+	cat, err := catalog.Open(ctx, "data/gozam.db")
+	if err != nil {
+		log.Fatalf("failed to open catalog: %v", err)
+	}
+	defer cat.Close()
+
+	if *cover {
+		opts := recognizer.DefaultCoverOptions
+		opts.Threshold = *coverThreshold
+		if err := searchCovers(ctx, cat, opts, *duration); err != nil {
+			log.Fatalf("failed to search covers: %v", err)
+		}
+		return
+	}
+
+	algorithmName, cfg, err := resolveFingerprinter(ctx, cat, *algorithm, *configName)
 	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+		log.Fatalf("failed to create fingerprinter: %v", err)
 	}
-	defer db.Close()
 
-	queries := database.New(db)
+	opts := recognizer.DefaultOptions
+	opts.Threshold, opts.Margin, opts.HashTolerance = *threshold, *scoreMargin, *tolerance
+	opts.MaxSpeedDeviation = *speed
+
+	rec, err := recognizer.New(ctx, cat, algorithmName, cfg, opts)
+	if err != nil {
+		log.Fatalf("failed to create recognizer: %v", err)
+	}
 
 	// Initialize PortAudio
 	portaudio.Initialize()
 	defer portaudio.Terminate()
 
-	// Start capturing microphone input
-	fmt.Println("Recording audio for song recognition...")
-	buffer, err := recordAudio(DURATION)
+	// Match the recording as it comes in and stop as soon as one song clearly leads
+	query, err := rec.NewQuery(audio.Format{SampleRate: cfg.SampleRate, NumChannels: 1})
+	if err != nil {
+		log.Fatalf("failed to create query: %v", err)
+	}
+
+	fmt.Printf("Listening for up to %d seconds...\n", *duration)
+	start := time.Now()
+	early := false
+	buffer, err := recordAudio(*duration, cfg.SampleRate, func(chunk []int16) (bool, error) {
+		samples := make([]float64, len(chunk))
+		for i, x := range chunk {
+			samples[i] = float64(x)
+		}
+
+		done, err := query.Write(ctx, samples)
+		early = done
+		return done, err
+	})
 	if err != nil {
 		log.Fatalf("failed to record audio: %v", err)
 	}
 
-	err = saveAudioBufferToFile("debug_recording.wav", buffer, SAMPLE_RATE)
+	elapsed := time.Since(start)
+	if !early {
+		if err := query.Flush(ctx); err != nil {
+			log.Fatalf("failed to fingerprint recording: %v", err)
+		}
+	}
+
+	seconds := float64(len(buffer)) / float64(cfg.SampleRate)
+	if early {
+		fmt.Printf("Answered after %.1fs (%.1fs of audio)\n", elapsed.Seconds(), seconds)
+	} else {
+		fmt.Printf("No confident answer after %.1fs (%.1fs of audio), matching the whole recording\n", elapsed.Seconds(), seconds)
+	}
+
+	err = saveAudioBufferToFile("debug_recording.wav", buffer, cfg.SampleRate)
 	if err != nil {
 		log.Fatalf("failed to save audio: %v", err)
 	}
 
-	intBuffer := make([]int, len(buffer))
-	for i, x := range buffer {
-		intBuffer[i] = int(x)
+	// Try to find a match in the database
+	matches, err := query.Candidates(ctx)
+	if errors.Is(err, recognizer.ErrMostlySilent) {
+		fmt.Printf("The recording is mostly silence (%.1fs of %.1fs active), try again closer to the music\n", query.ActiveDuration(), query.Duration())
+		return
+	} else if err != nil {
+		log.Fatalf("error searching for matching song: %v", err)
 	}
 
-	// Convert captured data into an audio buffer
-	audioBuffer := &audio.IntBuffer{
-		Data:           intBuffer,
-		Format:         &audio.Format{SampleRate: SAMPLE_RATE, NumChannels: 1},
+	if _, err := rec.Best(matches); errors.Is(err, recognizer.ErrNoMatch) {
+		fmt.Println("No match")
+	}
+
+	_, subFingerprints := rec.Fingerprinter().(fingerprint.SubFingerprinter)
+	for _, match := range matches[:min(MATCHES_SHOWN, len(matches))] {
+		if subFingerprints {
+			fmt.Printf(
+				"Song: '%s', Position: %s (now %s), Bit errors: %.1f%%, Confidence: %.4f\n",
+				match.Song.Name, formatPosition(match.Offset), formatPosition(match.Offset+query.Duration()),
+				match.BitErrorRate*100, match.Confidence,
+			)
+			continue
+		}
+
+		fmt.Printf(
+			"Song: '%s', Position: %s (now %s), Speed: %+.1f%%, Pitch: %s, Score: %d of %d hashes, Confidence: %.4f\n",
+			match.Song.Name, formatPosition(match.Offset), formatPosition(match.Offset+match.Speed*query.Duration()),
+			(match.Speed-1)*100, formatPitch(match.Pitch), match.Score, match.Hashes, match.Confidence,
+		)
+	}
+}
+
+// searchCovers records for the whole duration and lists the songs the recording is most likely a
+// cover of. Beats and chroma need the whole recording, so it can't answer early.
+func searchCovers(ctx context.Context, cat catalog.Catalog, opts recognizer.CoverOptions, duration int) error {
+	search, err := recognizer.NewCoverSearch(ctx, cat, opts)
+	if err != nil {
+		return err
+	}
+	sampleRate := search.Config().SampleRate
+
+	fmt.Printf("Listening for %d seconds...\n", duration)
+	buffer, err := recordAudio(duration, sampleRate, func(chunk []int16) (bool, error) {
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record audio: %w", err)
+	}
+
+	if err := saveAudioBufferToFile("debug_recording.wav", buffer, sampleRate); err != nil {
+		return fmt.Errorf("failed to save audio: %w", err)
+	}
+
+	data := make([]int, len(buffer))
+	for i, x := range buffer {
+		data[i] = int(x)
+	}
+	matches, err := search.Search(ctx, &audio.IntBuffer{
+		Data:           data,
+		Format:         &audio.Format{SampleRate: sampleRate, NumChannels: 1},
 		SourceBitDepth: 16,
+	})
+	if err != nil {
+		return err
 	}
 
-	// Generate fingerprint from recorded audio
-	songFingerprint := fingerprint.GetFingerPrint2(audioBuffer, BIN_SIZE, OVERLAP, HASH_TOP_N, MAX_TOKEN_TIME_DFF, 3)
+	if _, err := search.Best(matches); errors.Is(err, recognizer.ErrNoMatch) {
+		fmt.Println("No match")
+	}
 
-	// Try to find a match in the database
-	matchedSong, err := findMatchingSong(ctx, queries, songFingerprint)
+	for _, match := range matches[:min(MATCHES_SHOWN, len(matches))] {
+		fmt.Printf(
+			"Song: '%s', Position: %s, Transposed: %+d semitones, Tempo: x%g, Similarity: %.3f, Score: %.1f\n",
+			match.Song.Name, formatPosition(match.Offset), match.Transposition, match.Tempo, match.Similarity, match.Score,
+		)
+	}
+	return nil
+}
+
+// formatPosition formats a position in a song as minutes and seconds
+func formatPosition(seconds float64) string {
+	sign := ""
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+
+	// round to tenths first so 59.96s becomes 1:00.0 rather than 0:60.0
+	tenths := int(math.Round(seconds * 10))
+	return fmt.Sprintf("%s%d:%02d.%d", sign, tenths/600, tenths%600/10, tenths%10)
+}
+
+// formatPitch formats a match's pitch as a percentage change. Algorithms whose hashes are the same at
+// any pitch can't estimate it.
+func formatPitch(pitch float64) string {
+	if pitch == 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%+.1f%%", (pitch-1)*100)
+}
+
+// resolveFingerprinter picks the algorithm and config to fingerprint the recording with. They
+// default to the catalog's, and any requested on the command line must be compatible with it.
+func resolveFingerprinter(ctx context.Context, cat catalog.Catalog, algorithm, configName string) (string, fingerprint.Config, error) {
+	infos, err := cat.Infos(ctx)
 	if err != nil {
-		log.Fatalf("error searching for matching song: %v", err)
+		return "", fingerprint.Config{}, err
 	}
 
-	if len(matchedSong) != 0 {
-		songs := make([]struct {
-			string
-			float32
-		}, len(matchedSong))
-		for songName, perc := range matchedSong {
-			songs = append(songs, struct {
-				string
-				float32
-			}{songName, perc})
+	if len(infos) == 0 {
+		return "", fingerprint.Config{}, errors.New("catalog has no fingerprint info, build it with compute_db")
+	}
+
+	var info *catalog.Info
+	for i := range infos {
+		if infos[i].Algorithm.Name == algorithm || (algorithm == "" && len(infos) == 1) {
+			info = &infos[i]
 		}
+	}
 
-		sort.Slice(songs, func(i, j int) bool {
-			return songs[i].float32 > songs[j].float32
-		})
+	if info == nil {
+		algorithms := make([]string, len(infos))
+		for i := range infos {
+			algorithms[i] = infos[i].Algorithm.Name
+		}
+		if algorithm == "" {
+			return "", fingerprint.Config{}, fmt.Errorf("catalog holds fingerprints for [%s], choose one with -algo", strings.Join(algorithms, ", "))
+		}
+		return "", fingerprint.Config{}, fmt.Errorf("%w: catalog holds fingerprints for [%s], not '%s'", fingerprint.ErrIncompatible, strings.Join(algorithms, ", "), algorithm)
+	}
 
-		for _, song := range songs[:3] {
-			fmt.Printf("Song: '%s', Match: %f\n", song.string, song.float32*100)
+	cfg := info.Config
+	if configName != "" {
+		if cfg, err = fingerprint.ResolveConfig(configName); err != nil {
+			return "", fingerprint.Config{}, fmt.Errorf("failed to load config: %w", err)
 		}
-	} else {
-		fmt.Println("No matching song found with normal hash... using closest hash algo now")
 	}
+
+	return info.Algorithm.Name, cfg, nil
 }
 
-func recordAudio(seconds int) ([]int16, error) {
+// recordAudio records from the default input device for up to the given number of seconds, passing
+// each chunk to onChunk as it arrives. Recording stops early when onChunk returns true or on an
+// interrupt, and the audio recorded so far is returned.
+func recordAudio(seconds, sampleRate int, onChunk func(chunk []int16) (bool, error)) ([]int16, error) {
 	// Initialize PortAudio
 	err := portaudio.Initialize()
 	if err != nil {
@@ -116,7 +274,7 @@ func recordAudio(seconds int) ([]int16, error) {
 	stream, err := portaudio.OpenDefaultStream(
 		1, // num input channels
 		0, // num output channels
-		float64(SAMPLE_RATE),
+		float64(sampleRate),
 		BUFFER_SIZE,
 		&tempBuffer, // input buffer pointer
 	)
@@ -126,7 +284,7 @@ func recordAudio(seconds int) ([]int16, error) {
 	defer stream.Close()
 
 	// Main buffer to store entire recording
-	mainBuffer := make([]int16, SAMPLE_RATE*seconds)
+	mainBuffer := make([]int16, sampleRate*seconds)
 
 	// Handle interrupts
 	stop := make(chan struct{})
@@ -159,89 +317,18 @@ func recordAudio(seconds int) ([]int16, error) {
 			// Copy from temp buffer to main buffer
 			n := copy(mainBuffer[index:], tempBuffer)
 			index += n
-		}
-	}
-
-	return mainBuffer, nil
-}
-
-// findMatchingSong queries the database for a song with the most matching hashes
-func findMatchingSong(ctx context.Context, queries *database.Queries, fingerprint fingerprint.Fingerprint) (map[string]float32, error) {
-	matchCounts := make(map[int64]int)
-
-	// Query for each hash in the fingerprint
-	for hash := range fingerprint.Hashes {
-		songHashes, err := queries.GetSongByHash(ctx, int64(hash))
-		if err != nil {
-			return nil, fmt.Errorf("failed to query song hashes: %w", err)
-		}
 
-		// Count matches per song
-		for _, song := range songHashes {
-			matchCounts[song.ID]++
-		}
-	}
-
-	res, total := make(map[string]float32), 0
-	for songID, count := range matchCounts {
-		song, err := queries.GetSongByID(ctx, songID)
-		if err != nil {
-			continue
-		}
-
-		res[song.Name] = float32(count)
-		total += count
-	}
-
-	for song := range res {
-		res[song] /= float32(total)
-	}
-
-	return res, nil
-}
-
-func findMatchingSongClosest(ctx context.Context, queries *database.Queries, fingerprint fingerprint.Fingerprint, tolerance int64) (string, error) {
-	matchCounts := make(map[int64]int)
-
-	// Query for each hash in the fingerprint
-	for hash := range fingerprint.Hashes {
-		// Find closest hashes within the specified tolerance
-		closestHashes, err := queries.GetClosestHashes(ctx, database.GetClosestHashesParams{
-			TargetHash: int64(hash),
-			Tolerance:  tolerance,
-		})
-		if err != nil {
-			return "", fmt.Errorf("failed to query closest hashes: %w", err)
-		}
-
-		// Count matches per song
-		for _, song := range closestHashes {
-			matchCounts[song.ID]++
-		}
-	}
-
-	// Find song with the most matches
-	var bestMatchID int64
-	maxMatches := 0
-	for songID, count := range matchCounts {
-		if count > maxMatches {
-			bestMatchID = songID
-			maxMatches = count
+			done, err := onChunk(mainBuffer[index-n : index])
+			if err != nil {
+				return nil, err
+			}
+			if done {
+				return mainBuffer[:index], nil
+			}
 		}
 	}
 
-	// If no matches found, return empty
-	if maxMatches == 0 {
-		return "", nil
-	}
-
-	// Get song name by ID
-	song, err := queries.GetSongByID(ctx, bestMatchID)
-	if err != nil {
-		return "", fmt.Errorf("failed to get song name: %w", err)
-	}
-
-	return song.Name, nil
+	return mainBuffer, nil
 }
 
 func saveAudioBufferToFile(filename string, buffer []int16, sampleRate int) error {
@@ -2,28 +2,76 @@
 INSERT INTO songs (name) VALUES (?) RETURNING id;
 
 -- name: InsertSongHash :exec
-INSERT INTO song_hashes (song_id, song_hash) VALUES (?, ?);
+INSERT INTO song_hashes (algorithm, song_id, song_hash, song_time) VALUES (?, ?, ?, ?);
 
 -- name: GetSongByID :one
 SELECT id, name FROM songs WHERE id = ?;
 
+-- name: GetSongByName :one
+SELECT id, name FROM songs WHERE name = ? ORDER BY id LIMIT 1;
+
 -- name: GetSongByHash :many
-SELECT songs.id, songs.name 
+SELECT songs.id, songs.name, song_hashes.song_time
 FROM songs 
 JOIN song_hashes ON songs.id = song_hashes.song_id 
-WHERE song_hashes.song_hash = ?;
+WHERE song_hashes.algorithm = ? AND song_hashes.song_hash = ?;
+
+-- name: GetSongHashes :many
+SELECT song_hash, song_time FROM song_hashes
+WHERE algorithm = ? AND song_id = ? AND song_time BETWEEN ? AND ?
+ORDER BY song_time;
+
+-- name: HasSongHashes :one
+SELECT EXISTS (SELECT 1 FROM song_hashes WHERE algorithm = ? AND song_id = ?) AS has_hashes;
 
 -- name: GetClosestHashes :many
-SELECT songs.id, songs.name
+SELECT songs.id, songs.name, song_hashes.song_time
 FROM songs
 JOIN song_hashes ON songs.id = song_hashes.song_id
-WHERE song_hashes.song_hash BETWEEN @target_hash - @tolerance AND @target_hash + @tolerance;
+WHERE song_hashes.algorithm = @algorithm
+    AND song_hashes.song_hash BETWEEN @target_hash - @tolerance AND @target_hash + @tolerance;
 
 -- name: RemoveSharedHashes :exec
 DELETE FROM song_hashes
-WHERE song_hash IN (
-    SELECT song_hash
-    FROM song_hashes
-    GROUP BY song_hash
-    HAVING COUNT(DISTINCT song_id) > 1
-);
\ No newline at end of file
+WHERE algorithm = @algorithm
+    AND song_hash IN (
+        SELECT song_hash
+        FROM song_hashes
+        WHERE algorithm = @algorithm
+        GROUP BY song_hash
+        HAVING COUNT(DISTINCT song_id) > 1
+    );
+
+-- name: InsertCatalogInfo :exec
+INSERT INTO catalog_info (algorithm, version, config, sample_rate, created_at) VALUES (?, ?, ?, ?, ?);
+
+-- name: GetCatalogInfo :one
+SELECT algorithm, version, config, sample_rate, created_at FROM catalog_info WHERE algorithm = ?;
+
+-- name: ListCatalogInfo :many
+SELECT algorithm, version, config, sample_rate, created_at FROM catalog_info ORDER BY algorithm;
+
+-- name: GetCatalogStats :one
+SELECT
+    COUNT(*) AS hashes,
+    COUNT(DISTINCT song_hash) AS distinct_hashes,
+    COUNT(DISTINCT song_id) AS songs,
+    CAST(COALESCE((
+        SELECT SUM(song_frames)
+        FROM (SELECT MAX(song_time) + 1 AS song_frames FROM song_hashes WHERE algorithm = @algorithm GROUP BY song_id)
+    ), 0) AS INTEGER) AS frames,
+    CAST(COALESCE((
+        SELECT SUM(hash_rows * hash_rows)
+        FROM (SELECT COUNT(*) AS hash_rows FROM song_hashes WHERE algorithm = @algorithm GROUP BY song_hash)
+    ), 0) AS INTEGER) AS hash_pairs
+FROM song_hashes
+WHERE algorithm = @algorithm;
+
+-- name: InsertSongChroma :exec
+INSERT OR REPLACE INTO song_chroma (song_id, config, beats, chroma) VALUES (?, ?, ?, ?);
+
+-- name: HasSongChroma :one
+SELECT EXISTS (SELECT 1 FROM song_chroma WHERE song_id = ?) AS has_chroma;
+
+-- name: ListSongChroma :many
+SELECT song_id, config, beats, chroma FROM song_chroma ORDER BY song_id;
@@ -8,6 +8,28 @@ CREATE TABLE IF NOT EXISTS song_hashes (
     id INTEGER PRIMARY KEY,
     song_id INTEGER NOT NULL,
     song_hash INTEGER NOT NULL,
+    song_time INTEGER NOT NULL,
+    algorithm text NOT NULL DEFAULT '',
+
+    FOREIGN KEY (song_id) REFERENCES songs (id)
+);
+
+CREATE INDEX IF NOT EXISTS song_hashes_algorithm_song_hash ON song_hashes (algorithm, song_hash);
+CREATE INDEX IF NOT EXISTS song_hashes_algorithm_song_id ON song_hashes (algorithm, song_id, song_time);
+
+CREATE TABLE IF NOT EXISTS catalog_info (
+    algorithm text PRIMARY KEY,
+    version INTEGER NOT NULL,
+    config text NOT NULL,
+    sample_rate INTEGER NOT NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS song_chroma (
+    song_id INTEGER PRIMARY KEY,
+    config text NOT NULL,
+    beats BLOB NOT NULL,
+    chroma BLOB NOT NULL,
 
     FOREIGN KEY (song_id) REFERENCES songs (id)
 );
\ No newline at end of file
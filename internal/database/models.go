@@ -4,13 +4,30 @@
 
 package database
 
+type CatalogInfo struct {
+	Algorithm  string
+	Version    int64
+	Config     string
+	SampleRate int64
+	CreatedAt  int64
+}
+
 type Song struct {
 	ID   int64
 	Name string
 }
 
+type SongChroma struct {
+	SongID int64
+	Config string
+	Beats  []byte
+	Chroma []byte
+}
+
 type SongHash struct {
-	ID       int64
-	SongID   int64
-	SongHash int64
+	ID        int64
+	SongID    int64
+	SongHash  int64
+	SongTime  int64
+	Algorithm string
 }
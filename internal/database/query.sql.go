@@ -9,28 +9,91 @@ import (
 	"context"
 )
 
+const getCatalogInfo = `-- name: GetCatalogInfo :one
+SELECT algorithm, version, config, sample_rate, created_at FROM catalog_info WHERE algorithm = ?
+`
+
+func (q *Queries) GetCatalogInfo(ctx context.Context, algorithm string) (CatalogInfo, error) {
+	row := q.db.QueryRowContext(ctx, getCatalogInfo, algorithm)
+	var i CatalogInfo
+	err := row.Scan(
+		&i.Algorithm,
+		&i.Version,
+		&i.Config,
+		&i.SampleRate,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getCatalogStats = `-- name: GetCatalogStats :one
+SELECT
+    COUNT(*) AS hashes,
+    COUNT(DISTINCT song_hash) AS distinct_hashes,
+    COUNT(DISTINCT song_id) AS songs,
+    CAST(COALESCE((
+        SELECT SUM(song_frames)
+        FROM (SELECT MAX(song_time) + 1 AS song_frames FROM song_hashes WHERE algorithm = ?1 GROUP BY song_id)
+    ), 0) AS INTEGER) AS frames,
+    CAST(COALESCE((
+        SELECT SUM(hash_rows * hash_rows)
+        FROM (SELECT COUNT(*) AS hash_rows FROM song_hashes WHERE algorithm = ?1 GROUP BY song_hash)
+    ), 0) AS INTEGER) AS hash_pairs
+FROM song_hashes
+WHERE algorithm = ?1
+`
+
+type GetCatalogStatsRow struct {
+	Hashes         int64
+	DistinctHashes int64
+	Songs          int64
+	Frames         int64
+	HashPairs      int64
+}
+
+func (q *Queries) GetCatalogStats(ctx context.Context, algorithm string) (GetCatalogStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, getCatalogStats, algorithm)
+	var i GetCatalogStatsRow
+	err := row.Scan(
+		&i.Hashes,
+		&i.DistinctHashes,
+		&i.Songs,
+		&i.Frames,
+		&i.HashPairs,
+	)
+	return i, err
+}
+
 const getClosestHashes = `-- name: GetClosestHashes :many
-SELECT songs.id, songs.name
+SELECT songs.id, songs.name, song_hashes.song_time
 FROM songs
 JOIN song_hashes ON songs.id = song_hashes.song_id
-WHERE song_hashes.song_hash BETWEEN ?1 - ?2 AND ?1 + ?2
+WHERE song_hashes.algorithm = ?1
+    AND song_hashes.song_hash BETWEEN ?2 - ?3 AND ?2 + ?3
 `
 
 type GetClosestHashesParams struct {
+	Algorithm  string
 	TargetHash interface{}
 	Tolerance  interface{}
 }
 
-func (q *Queries) GetClosestHashes(ctx context.Context, arg GetClosestHashesParams) ([]Song, error) {
-	rows, err := q.db.QueryContext(ctx, getClosestHashes, arg.TargetHash, arg.Tolerance)
+type GetClosestHashesRow struct {
+	ID       int64
+	Name     string
+	SongTime int64
+}
+
+func (q *Queries) GetClosestHashes(ctx context.Context, arg GetClosestHashesParams) ([]GetClosestHashesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getClosestHashes, arg.Algorithm, arg.TargetHash, arg.Tolerance)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Song
+	var items []GetClosestHashesRow
 	for rows.Next() {
-		var i Song
-		if err := rows.Scan(&i.ID, &i.Name); err != nil {
+		var i GetClosestHashesRow
+		if err := rows.Scan(&i.ID, &i.Name, &i.SongTime); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -45,22 +108,33 @@ func (q *Queries) GetClosestHashes(ctx context.Context, arg GetClosestHashesPara
 }
 
 const getSongByHash = `-- name: GetSongByHash :many
-SELECT songs.id, songs.name 
+SELECT songs.id, songs.name, song_hashes.song_time
 FROM songs 
 JOIN song_hashes ON songs.id = song_hashes.song_id 
-WHERE song_hashes.song_hash = ?
+WHERE song_hashes.algorithm = ? AND song_hashes.song_hash = ?
 `
 
-func (q *Queries) GetSongByHash(ctx context.Context, songHash int64) ([]Song, error) {
-	rows, err := q.db.QueryContext(ctx, getSongByHash, songHash)
+type GetSongByHashParams struct {
+	Algorithm string
+	SongHash  int64
+}
+
+type GetSongByHashRow struct {
+	ID       int64
+	Name     string
+	SongTime int64
+}
+
+func (q *Queries) GetSongByHash(ctx context.Context, arg GetSongByHashParams) ([]GetSongByHashRow, error) {
+	rows, err := q.db.QueryContext(ctx, getSongByHash, arg.Algorithm, arg.SongHash)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Song
+	var items []GetSongByHashRow
 	for rows.Next() {
-		var i Song
-		if err := rows.Scan(&i.ID, &i.Name); err != nil {
+		var i GetSongByHashRow
+		if err := rows.Scan(&i.ID, &i.Name, &i.SongTime); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -85,6 +159,113 @@ func (q *Queries) GetSongByID(ctx context.Context, id int64) (Song, error) {
 	return i, err
 }
 
+const getSongByName = `-- name: GetSongByName :one
+SELECT id, name FROM songs WHERE name = ? ORDER BY id LIMIT 1
+`
+
+func (q *Queries) GetSongByName(ctx context.Context, name string) (Song, error) {
+	row := q.db.QueryRowContext(ctx, getSongByName, name)
+	var i Song
+	err := row.Scan(&i.ID, &i.Name)
+	return i, err
+}
+
+const getSongHashes = `-- name: GetSongHashes :many
+SELECT song_hash, song_time FROM song_hashes
+WHERE algorithm = ? AND song_id = ? AND song_time BETWEEN ? AND ?
+ORDER BY song_time
+`
+
+type GetSongHashesParams struct {
+	Algorithm  string
+	SongID     int64
+	SongTime   int64
+	SongTime_2 int64
+}
+
+type GetSongHashesRow struct {
+	SongHash int64
+	SongTime int64
+}
+
+func (q *Queries) GetSongHashes(ctx context.Context, arg GetSongHashesParams) ([]GetSongHashesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getSongHashes,
+		arg.Algorithm,
+		arg.SongID,
+		arg.SongTime,
+		arg.SongTime_2,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetSongHashesRow
+	for rows.Next() {
+		var i GetSongHashesRow
+		if err := rows.Scan(&i.SongHash, &i.SongTime); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hasSongChroma = `-- name: HasSongChroma :one
+SELECT EXISTS (SELECT 1 FROM song_chroma WHERE song_id = ?) AS has_chroma
+`
+
+func (q *Queries) HasSongChroma(ctx context.Context, songID int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, hasSongChroma, songID)
+	var has_chroma int64
+	err := row.Scan(&has_chroma)
+	return has_chroma, err
+}
+
+const hasSongHashes = `-- name: HasSongHashes :one
+SELECT EXISTS (SELECT 1 FROM song_hashes WHERE algorithm = ? AND song_id = ?) AS has_hashes
+`
+
+type HasSongHashesParams struct {
+	Algorithm string
+	SongID    int64
+}
+
+func (q *Queries) HasSongHashes(ctx context.Context, arg HasSongHashesParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, hasSongHashes, arg.Algorithm, arg.SongID)
+	var has_hashes int64
+	err := row.Scan(&has_hashes)
+	return has_hashes, err
+}
+
+const insertCatalogInfo = `-- name: InsertCatalogInfo :exec
+INSERT INTO catalog_info (algorithm, version, config, sample_rate, created_at) VALUES (?, ?, ?, ?, ?)
+`
+
+type InsertCatalogInfoParams struct {
+	Algorithm  string
+	Version    int64
+	Config     string
+	SampleRate int64
+	CreatedAt  int64
+}
+
+func (q *Queries) InsertCatalogInfo(ctx context.Context, arg InsertCatalogInfoParams) error {
+	_, err := q.db.ExecContext(ctx, insertCatalogInfo,
+		arg.Algorithm,
+		arg.Version,
+		arg.Config,
+		arg.SampleRate,
+		arg.CreatedAt,
+	)
+	return err
+}
+
 const insertSong = `-- name: InsertSong :one
 INSERT INTO songs (name) VALUES (?) RETURNING id
 `
@@ -96,31 +277,126 @@ func (q *Queries) InsertSong(ctx context.Context, name string) (int64, error) {
 	return id, err
 }
 
+const insertSongChroma = `-- name: InsertSongChroma :exec
+INSERT OR REPLACE INTO song_chroma (song_id, config, beats, chroma) VALUES (?, ?, ?, ?)
+`
+
+type InsertSongChromaParams struct {
+	SongID int64
+	Config string
+	Beats  []byte
+	Chroma []byte
+}
+
+func (q *Queries) InsertSongChroma(ctx context.Context, arg InsertSongChromaParams) error {
+	_, err := q.db.ExecContext(ctx, insertSongChroma,
+		arg.SongID,
+		arg.Config,
+		arg.Beats,
+		arg.Chroma,
+	)
+	return err
+}
+
 const insertSongHash = `-- name: InsertSongHash :exec
-INSERT INTO song_hashes (song_id, song_hash) VALUES (?, ?)
+INSERT INTO song_hashes (algorithm, song_id, song_hash, song_time) VALUES (?, ?, ?, ?)
 `
 
 type InsertSongHashParams struct {
-	SongID   int64
-	SongHash int64
+	Algorithm string
+	SongID    int64
+	SongHash  int64
+	SongTime  int64
 }
 
 func (q *Queries) InsertSongHash(ctx context.Context, arg InsertSongHashParams) error {
-	_, err := q.db.ExecContext(ctx, insertSongHash, arg.SongID, arg.SongHash)
+	_, err := q.db.ExecContext(ctx, insertSongHash,
+		arg.Algorithm,
+		arg.SongID,
+		arg.SongHash,
+		arg.SongTime,
+	)
 	return err
 }
 
+const listCatalogInfo = `-- name: ListCatalogInfo :many
+SELECT algorithm, version, config, sample_rate, created_at FROM catalog_info ORDER BY algorithm
+`
+
+func (q *Queries) ListCatalogInfo(ctx context.Context) ([]CatalogInfo, error) {
+	rows, err := q.db.QueryContext(ctx, listCatalogInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CatalogInfo
+	for rows.Next() {
+		var i CatalogInfo
+		if err := rows.Scan(
+			&i.Algorithm,
+			&i.Version,
+			&i.Config,
+			&i.SampleRate,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSongChroma = `-- name: ListSongChroma :many
+SELECT song_id, config, beats, chroma FROM song_chroma ORDER BY song_id
+`
+
+func (q *Queries) ListSongChroma(ctx context.Context) ([]SongChroma, error) {
+	rows, err := q.db.QueryContext(ctx, listSongChroma)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SongChroma
+	for rows.Next() {
+		var i SongChroma
+		if err := rows.Scan(
+			&i.SongID,
+			&i.Config,
+			&i.Beats,
+			&i.Chroma,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const removeSharedHashes = `-- name: RemoveSharedHashes :exec
 DELETE FROM song_hashes
-WHERE song_hash IN (
-    SELECT song_hash
-    FROM song_hashes
-    GROUP BY song_hash
-    HAVING COUNT(DISTINCT song_id) > 1
-)
+WHERE algorithm = ?1
+    AND song_hash IN (
+        SELECT song_hash
+        FROM song_hashes
+        WHERE algorithm = ?1
+        GROUP BY song_hash
+        HAVING COUNT(DISTINCT song_id) > 1
+    )
 `
 
-func (q *Queries) RemoveSharedHashes(ctx context.Context) error {
-	_, err := q.db.ExecContext(ctx, removeSharedHashes)
+func (q *Queries) RemoveSharedHashes(ctx context.Context, algorithm string) error {
+	_, err := q.db.ExecContext(ctx, removeSharedHashes, algorithm)
 	return err
 }
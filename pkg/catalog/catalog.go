@@ -0,0 +1,82 @@
+// module for storing and looking up the fingerprints of reference songs
+package catalog
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+)
+
+var ErrNotFound = errors.New("not found in catalog")
+
+// Song is a reference song and its metadata
+type Song struct {
+	ID   int64
+	Name string
+}
+
+// Hit is an occurrence of a hash in a song. Time is the frame of the anchor token that produced it.
+type Hit struct {
+	SongID int64
+	Time   int
+}
+
+// SongHash is a hash of a song and the frame it occurs at
+type SongHash struct {
+	Hash fingerprint.TokenPairHash
+	Time int
+}
+
+// SongChroma is the beat-synchronous chroma of a song used by cover search, and the config it was
+// computed with
+type SongChroma struct {
+	SongID int64
+	Config fingerprint.Config
+	fingerprint.BeatChroma
+}
+
+// Info records the algorithm and config a catalog's hashes were computed with
+type Info struct {
+	Algorithm fingerprint.Algorithm
+	Config    fingerprint.Config
+	CreatedAt time.Time
+}
+
+// Stats summarise the size of one algorithm's hashes in a catalog. Frames is the total length of the
+// songs fingerprinted with it in frames. HashPairs is the number of pairs of rows sharing a hash,
+// counting each row paired with itself, which measures how unevenly rows are spread over hashes.
+type Stats struct {
+	Hashes         int64
+	DistinctHashes int64
+	Songs          int64
+	Frames         int64
+	HashPairs      int64
+}
+
+// Catalog is a database of reference fingerprints that queries are matched against. Hashes are
+// tagged with the algorithm that computed them, so one catalog can hold the hashes of several
+// algorithms and each is only matched against its own.
+type Catalog interface {
+	// Info returns the info of the named algorithm's hashes, or ErrNotFound
+	Info(ctx context.Context, algorithm string) (Info, error)
+	// Infos lists the info of every algorithm with hashes in the catalog
+	Infos(ctx context.Context) ([]Info, error)
+
+	// Lookup finds every occurrence of the algorithm's hash
+	Lookup(ctx context.Context, algorithm string, hash fingerprint.TokenPairHash) ([]Hit, error)
+	// LookupNear finds every occurrence of hashes within tolerance of the hash. Only the time delta
+	// is held in the low bits of a landmark hash, so this tolerates small errors in the time delta.
+	LookupNear(ctx context.Context, algorithm string, hash fingerprint.TokenPairHash, tolerance int64) ([]Hit, error)
+	// SongHashes lists the algorithm's hashes of the song from frame from to frame to inclusive, by
+	// time
+	SongHashes(ctx context.Context, algorithm string, songID int64, from, to int) ([]SongHash, error)
+
+	// Chromas lists the beat chroma of every song that has one
+	Chromas(ctx context.Context) ([]SongChroma, error)
+
+	// Song returns the song with the given ID, or ErrNotFound
+	Song(ctx context.Context, id int64) (Song, error)
+	Stats(ctx context.Context, algorithm string) (Stats, error)
+}
@@ -0,0 +1,389 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/RobertMNewton/gozam/internal/database"
+	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+)
+
+// schema matches data/schema/schema.sql. The index is created after migrating older catalogs, as
+// their song_hashes table has no algorithm column until then.
+const (
+	schema = `
+CREATE TABLE IF NOT EXISTS songs (
+    id INTEGER PRIMARY KEY,
+    name text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS song_hashes (
+    id INTEGER PRIMARY KEY,
+    song_id INTEGER NOT NULL,
+    song_hash INTEGER NOT NULL,
+    song_time INTEGER NOT NULL,
+    algorithm text NOT NULL DEFAULT '',
+    FOREIGN KEY (song_id) REFERENCES songs (id)
+);
+
+CREATE TABLE IF NOT EXISTS catalog_info (
+    algorithm text PRIMARY KEY,
+    version INTEGER NOT NULL,
+    config text NOT NULL,
+    sample_rate INTEGER NOT NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS song_chroma (
+    song_id INTEGER PRIMARY KEY,
+    config text NOT NULL,
+    beats BLOB NOT NULL,
+    chroma BLOB NOT NULL,
+
+    FOREIGN KEY (song_id) REFERENCES songs (id)
+);
+`
+
+	index = `
+DROP INDEX IF EXISTS song_hashes_song_hash;
+CREATE INDEX IF NOT EXISTS song_hashes_algorithm_song_hash ON song_hashes (algorithm, song_hash);
+CREATE INDEX IF NOT EXISTS song_hashes_algorithm_song_id ON song_hashes (algorithm, song_id, song_time);
+`
+)
+
+// SQLite is a Catalog stored in a sqlite database
+type SQLite struct {
+	db      *sql.DB
+	queries *database.Queries
+}
+
+// Open opens the sqlite catalog at path, creating its tables if they don't exist yet
+func Open(ctx context.Context, path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create tables in database: %w", err)
+	}
+
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	if _, err := db.ExecContext(ctx, index); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create indexes in database: %w", err)
+	}
+
+	return &SQLite{db: db, queries: database.New(db)}, nil
+}
+
+// migrate tags the hashes of catalogs created before hashes were tagged by algorithm. Such catalogs
+// only ever held one algorithm's hashes, so they are tagged with the algorithm in catalog_info. If
+// catalog_info doesn't name exactly one algorithm the hashes can't be tagged, and the catalog is
+// left untouched with an error rather than with hashes no lookup can reach.
+func migrate(ctx context.Context, db *sql.DB) error {
+	var tagged int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info('song_hashes') WHERE name = 'algorithm'").Scan(&tagged)
+	if err != nil || tagged > 0 {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "ALTER TABLE song_hashes ADD COLUMN algorithm text NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+
+	var hashes, algorithms int
+	err = tx.QueryRowContext(ctx, "SELECT (SELECT COUNT(*) FROM song_hashes), (SELECT COUNT(*) FROM catalog_info)").Scan(&hashes, &algorithms)
+	if err != nil {
+		return err
+	}
+	if hashes > 0 && algorithms != 1 {
+		return fmt.Errorf("%d untagged hashes can't be tagged with an algorithm as catalog_info lists %d algorithms rather than 1, recompute the catalog", hashes, algorithms)
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE song_hashes SET algorithm = (SELECT algorithm FROM catalog_info)"); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (c *SQLite) Close() error {
+	return c.db.Close()
+}
+
+// AddSong adds a song to the catalog, returning its ID. A song already in the catalog under the same
+// name keeps its ID, so the catalog can be built with one algorithm after another.
+func (c *SQLite) AddSong(ctx context.Context, name string) (int64, error) {
+	song, err := c.queries.GetSongByName(ctx, name)
+	if err == nil {
+		return song.ID, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	return c.queries.InsertSong(ctx, name)
+}
+
+// HasFingerprint reports whether the song already has hashes computed with the algorithm
+func (c *SQLite) HasFingerprint(ctx context.Context, algorithm string, songID int64) (bool, error) {
+	has, err := c.queries.HasSongHashes(ctx, database.HasSongHashesParams{Algorithm: algorithm, SongID: songID})
+	return has != 0, err
+}
+
+// AddFingerprint stores a row for every time each of the fingerprint's hashes occurs in the song,
+// tagged with the algorithm that computed them
+func (c *SQLite) AddFingerprint(ctx context.Context, algorithm string, songID int64, songFingerprint fingerprint.Fingerprint) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := c.queries.WithTx(tx)
+	for hash, times := range songFingerprint.Hashes {
+		for _, time := range times {
+			err := queries.InsertSongHash(ctx, database.InsertSongHashParams{
+				Algorithm: algorithm,
+				SongID:    songID,
+				SongHash:  int64(hash),
+				SongTime:  int64(time),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to insert song hash: %w", err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// HasChroma reports whether the song's beat chroma is already stored
+func (c *SQLite) HasChroma(ctx context.Context, songID int64) (bool, error) {
+	has, err := c.queries.HasSongChroma(ctx, songID)
+	return has != 0, err
+}
+
+// AddChroma stores the song's beat chroma computed with the config, replacing any it already had.
+// Beats are stored as little endian uint32 frames and chroma as little endian float32s, pitch class
+// by pitch class and beat by beat.
+func (c *SQLite) AddChroma(ctx context.Context, songID int64, cfg fingerprint.Config, beatChroma fingerprint.BeatChroma) error {
+	config, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	beats := make([]byte, 0, 4*len(beatChroma.Beats))
+	for _, beat := range beatChroma.Beats {
+		beats = binary.LittleEndian.AppendUint32(beats, uint32(beat))
+	}
+
+	chroma := make([]byte, 0, 4*fingerprint.PitchClasses*len(beatChroma.Chroma))
+	for _, v := range beatChroma.Chroma {
+		for _, x := range v {
+			chroma = binary.LittleEndian.AppendUint32(chroma, math.Float32bits(float32(x)))
+		}
+	}
+
+	err = c.queries.InsertSongChroma(ctx, database.InsertSongChromaParams{
+		SongID: songID,
+		Config: string(config),
+		Beats:  beats,
+		Chroma: chroma,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert song chroma: %w", err)
+	}
+	return nil
+}
+
+func (c *SQLite) Chromas(ctx context.Context) ([]SongChroma, error) {
+	rows, err := c.queries.ListSongChroma(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query song chroma: %w", err)
+	}
+
+	res := make([]SongChroma, len(rows))
+	for i, row := range rows {
+		if len(row.Beats)%4 != 0 || len(row.Chroma) != len(row.Beats)*fingerprint.PitchClasses {
+			return nil, fmt.Errorf("malformed chroma for song %d", row.SongID)
+		}
+
+		res[i].SongID = row.SongID
+		if err := json.Unmarshal([]byte(row.Config), &res[i].Config); err != nil {
+			return nil, fmt.Errorf("failed to parse chroma config: %w", err)
+		}
+
+		res[i].Beats = make([]int, len(row.Beats)/4)
+		res[i].Chroma = make(fingerprint.Chromagram, len(row.Beats)/4)
+		for b := range res[i].Beats {
+			res[i].Beats[b] = int(binary.LittleEndian.Uint32(row.Beats[4*b:]))
+			for pc := range res[i].Chroma[b] {
+				bits := binary.LittleEndian.Uint32(row.Chroma[4*(b*fingerprint.PitchClasses+pc):])
+				res[i].Chroma[b][pc] = float64(math.Float32frombits(bits))
+			}
+		}
+	}
+	return res, nil
+}
+
+// SetInfo records the algorithm and config the catalog's hashes are computed with. Adding songs with
+// a fingerprinter other than the one the catalog was created with is refused.
+func (c *SQLite) SetInfo(ctx context.Context, fingerprinter fingerprint.Fingerprinter) error {
+	algorithm := fingerprinter.Algorithm()
+
+	info, err := c.Info(ctx, algorithm.Name)
+	if err == nil {
+		return fingerprint.CheckCompatible(fingerprinter, info.Algorithm, info.Config)
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	config, err := json.Marshal(fingerprinter.Config())
+	if err != nil {
+		return err
+	}
+
+	return c.queries.InsertCatalogInfo(ctx, database.InsertCatalogInfoParams{
+		Algorithm:  algorithm.Name,
+		Version:    int64(algorithm.Version),
+		Config:     string(config),
+		SampleRate: int64(fingerprinter.Config().SampleRate),
+		CreatedAt:  time.Now().Unix(),
+	})
+}
+
+func (c *SQLite) Info(ctx context.Context, algorithm string) (Info, error) {
+	info, err := c.queries.GetCatalogInfo(ctx, algorithm)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Info{}, fmt.Errorf("%w: no fingerprints for algorithm '%s'", ErrNotFound, algorithm)
+	} else if err != nil {
+		return Info{}, fmt.Errorf("failed to read catalog info: %w", err)
+	}
+
+	return parseInfo(info)
+}
+
+func (c *SQLite) Infos(ctx context.Context) ([]Info, error) {
+	infos, err := c.queries.ListCatalogInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog info: %w", err)
+	}
+
+	res := make([]Info, len(infos))
+	for i, info := range infos {
+		if res[i], err = parseInfo(info); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func parseInfo(info database.CatalogInfo) (Info, error) {
+	var cfg fingerprint.Config
+	if err := json.Unmarshal([]byte(info.Config), &cfg); err != nil {
+		return Info{}, fmt.Errorf("failed to parse catalog config: %w", err)
+	}
+
+	return Info{
+		Algorithm: fingerprint.Algorithm{Name: info.Algorithm, Version: int(info.Version)},
+		Config:    cfg,
+		CreatedAt: time.Unix(info.CreatedAt, 0),
+	}, nil
+}
+
+func (c *SQLite) Lookup(ctx context.Context, algorithm string, hash fingerprint.TokenPairHash) ([]Hit, error) {
+	rows, err := c.queries.GetSongByHash(ctx, database.GetSongByHashParams{
+		Algorithm: algorithm,
+		SongHash:  int64(hash),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query song hashes: %w", err)
+	}
+
+	hits := make([]Hit, len(rows))
+	for i, row := range rows {
+		hits[i] = Hit{SongID: row.ID, Time: int(row.SongTime)}
+	}
+	return hits, nil
+}
+
+func (c *SQLite) LookupNear(ctx context.Context, algorithm string, hash fingerprint.TokenPairHash, tolerance int64) ([]Hit, error) {
+	rows, err := c.queries.GetClosestHashes(ctx, database.GetClosestHashesParams{
+		Algorithm:  algorithm,
+		TargetHash: int64(hash),
+		Tolerance:  tolerance,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query closest hashes: %w", err)
+	}
+
+	hits := make([]Hit, len(rows))
+	for i, row := range rows {
+		hits[i] = Hit{SongID: row.ID, Time: int(row.SongTime)}
+	}
+	return hits, nil
+}
+
+func (c *SQLite) SongHashes(ctx context.Context, algorithm string, songID int64, from, to int) ([]SongHash, error) {
+	rows, err := c.queries.GetSongHashes(ctx, database.GetSongHashesParams{
+		Algorithm:  algorithm,
+		SongID:     songID,
+		SongTime:   int64(from),
+		SongTime_2: int64(to),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query song hashes: %w", err)
+	}
+
+	hashes := make([]SongHash, len(rows))
+	for i, row := range rows {
+		hashes[i] = SongHash{Hash: fingerprint.TokenPairHash(row.SongHash), Time: int(row.SongTime)}
+	}
+	return hashes, nil
+}
+
+func (c *SQLite) Song(ctx context.Context, id int64) (Song, error) {
+	song, err := c.queries.GetSongByID(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Song{}, fmt.Errorf("%w: no song with ID %d", ErrNotFound, id)
+	} else if err != nil {
+		return Song{}, err
+	}
+
+	return Song{ID: song.ID, Name: song.Name}, nil
+}
+
+func (c *SQLite) Stats(ctx context.Context, algorithm string) (Stats, error) {
+	stats, err := c.queries.GetCatalogStats(ctx, algorithm)
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to read catalog stats: %w", err)
+	}
+
+	return Stats{
+		Hashes:         stats.Hashes,
+		DistinctHashes: stats.DistinctHashes,
+		Songs:          stats.Songs,
+		Frames:         stats.Frames,
+		HashPairs:      stats.HashPairs,
+	}, nil
+}
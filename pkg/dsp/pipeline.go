@@ -0,0 +1,117 @@
+// module for composing audio recognition out of swappable dsp stages
+package dsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+	"github.com/go-audio/audio"
+)
+
+var ErrMissingInput = errors.New("stage input missing, is an earlier stage missing from the pipeline?")
+
+// Signal is the state passed down a pipeline. Each stage reads what the stages before it filled in
+// and fills in its own output.
+type Signal struct {
+	// Source is the encoded audio read by Decode
+	Source io.ReadSeeker
+	// Audio is the decoded audio as it was read, possibly with several channels
+	Audio audio.Buffer
+
+	// Samples are the mono samples at SampleRate that the time domain stages work on
+	Samples    []float64
+	SampleRate int
+
+	// Silent marks the frames of the Spectrogram that are silent, if any are marked
+	Silent []bool
+
+	Spectrogram fingerprint.Spectrogram
+	Tokens      []fingerprint.Token
+	Fingerprint fingerprint.Fingerprint
+}
+
+// Stage is one step of a pipeline
+type Stage interface {
+	Name() string
+	Process(sig *Signal) error
+}
+
+// Pipeline runs its stages in order
+type Pipeline []Stage
+
+// Run passes the signal through each stage, stopping at the first error or when ctx is done
+func (p Pipeline) Run(ctx context.Context, sig *Signal) error {
+	for _, stage := range p {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := stage.Process(sig); err != nil {
+			return fmt.Errorf("%s stage: %w", stage.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Fingerprint runs the pipeline over decoded audio
+func (p Pipeline) Fingerprint(ctx context.Context, audioBuff audio.Buffer) (fingerprint.Fingerprint, error) {
+	sig := Signal{Audio: audioBuff}
+	if err := p.Run(ctx, &sig); err != nil {
+		return fingerprint.Fingerprint{}, err
+	}
+	return sig.Fingerprint, nil
+}
+
+// Replace returns a copy of the pipeline with every stage of the given name swapped for stage
+func (p Pipeline) Replace(name string, stage Stage) Pipeline {
+	res := make(Pipeline, len(p))
+	for i := range p {
+		if p[i].Name() == name {
+			res[i] = stage
+		} else {
+			res[i] = p[i]
+		}
+	}
+	return res
+}
+
+// DefaultPipeline reproduces the fingerprints of the "windowed" fingerprint algorithm for the config.
+// Prepend a Decode stage to fingerprint encoded audio.
+func DefaultPipeline(cfg fingerprint.Config) (Pipeline, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	tokensPerWindow, err := fingerprint.WindowTokens(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// denoise and normalise as their own stages rather than as part of the STFT
+	opts := cfg.SpectrogramOptions()
+	denoise, normalise := Denoise{cfg.NoiseOptions()}, Normalise{cfg.NormaliseOptions()}
+	opts.NoiseSubtraction, opts.NoiseFrames = 0, 0
+	opts.Normalisation, opts.NormaliseFrames = fingerprint.NoNormalisation, 0
+
+	filter := Filter(func(samples []float64, sampleRate int) []float64 {
+		if f := fingerprint.NewAudioFilter(cfg.Filter, sampleRate); f != nil {
+			return f.Process(samples)
+		}
+		return samples
+	})
+
+	return Pipeline{
+		Downmix{},
+		Resample{SampleRate: cfg.SampleRate},
+		filter,
+		Silence{Config: cfg},
+		STFT{Options: opts},
+		denoise,
+		normalise,
+		WindowPeaks{TokensPerWindow: tokensPerWindow},
+		Hash{Zone: cfg.TargetZone()},
+	}, nil
+}
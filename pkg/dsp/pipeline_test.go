@@ -0,0 +1,62 @@
+package dsp
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+	"github.com/go-audio/audio"
+)
+
+// testAudio is a few seconds of stereo tones over noise, with a quiet intro and outro
+func testAudio() *audio.FloatBuffer {
+	const sampleRate, seconds = 44100, 8
+	rng := rand.New(rand.NewSource(1))
+
+	data := make([]float64, 2*sampleRate*seconds)
+	for i := 0; i < len(data)/2; i++ {
+		t := float64(i) / sampleRate
+		x := 5 * rng.NormFloat64()
+		if t > 2 && t < 6 {
+			hz := 300 + 150*math.Floor(4*t)
+			x += 8000*math.Sin(2*math.Pi*hz*t) + 2000*rng.NormFloat64()
+		}
+		data[2*i], data[2*i+1] = x, 0.5*x
+	}
+	return &audio.FloatBuffer{Data: data, Format: &audio.Format{SampleRate: sampleRate, NumChannels: 2}}
+}
+
+func TestDefaultPipelineMatchesWindowed(t *testing.T) {
+	for _, preset := range []string{"default", "noisy"} {
+		cfg, _ := fingerprint.Preset(preset)
+
+		windowed, err := fingerprint.New("windowed", cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := windowed.Fingerprint(testAudio())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pipeline, err := DefaultPipeline(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := pipeline.Fingerprint(context.Background(), testAudio())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(want.Tokens) == 0 {
+			t.Fatalf("%s: windowed found no tokens", preset)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: pipeline fingerprint has %d tokens, %d hashes and %d of %d frames silent, windowed has %d, %d and %d of %d",
+				preset, len(got.Tokens), len(got.Hashes), got.Silent, got.Frames, len(want.Tokens), len(want.Hashes), want.Silent, want.Frames)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package dsp
+
+import (
+	"math"
+
+	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+)
+
+// Decode reads the WAV encoded Source into Audio
+type Decode struct{}
+
+func (Decode) Name() string { return "decode" }
+
+func (Decode) Process(sig *Signal) error {
+	if sig.Source == nil {
+		return ErrMissingInput
+	}
+
+	buff, err := wav.NewDecoder(sig.Source).FullPCMBuffer()
+	if err != nil {
+		return err
+	}
+
+	sig.Audio = buff
+	return nil
+}
+
+// Downmix averages the channels of Audio into Samples
+type Downmix struct{}
+
+func (Downmix) Name() string { return "downmix" }
+
+func (Downmix) Process(sig *Signal) error {
+	if sig.Audio == nil {
+		return ErrMissingInput
+	}
+
+	format := sig.Audio.PCMFormat()
+	if format == nil || format.SampleRate <= 0 {
+		return fingerprint.ErrNoSampleRate
+	}
+
+	sig.Samples = fingerprint.Downmix(sig.Audio.AsFloatBuffer().Data, format.NumChannels)
+	sig.SampleRate = format.SampleRate
+	return nil
+}
+
+// Resample converts Samples to SampleRate
+type Resample struct {
+	SampleRate int
+}
+
+func (Resample) Name() string { return "resample" }
+
+func (r Resample) Process(sig *Signal) error {
+	if sig.SampleRate <= 0 {
+		return ErrMissingInput
+	}
+
+	sig.Samples = fingerprint.Resample(sig.Samples, sig.SampleRate, r.SampleRate)
+	sig.SampleRate = r.SampleRate
+	return nil
+}
+
+// Filter applies any sample level filter to Samples
+type Filter func(samples []float64, sampleRate int) []float64
+
+func (Filter) Name() string { return "filter" }
+
+func (f Filter) Process(sig *Signal) error {
+	if sig.SampleRate <= 0 {
+		return ErrMissingInput
+	}
+
+	sig.Samples = f(sig.Samples, sig.SampleRate)
+	return nil
+}
+
+// STFT computes the Spectrogram of Samples
+type STFT struct {
+	Options fingerprint.SpectrogramOptions
+}
+
+func (STFT) Name() string { return "stft" }
+
+func (s STFT) Process(sig *Signal) error {
+	if sig.SampleRate <= 0 {
+		return ErrMissingInput
+	}
+
+	if len(sig.Samples) < s.Options.BinSize {
+		return fingerprint.ErrAudioTooShort
+	}
+
+	buff := &audio.FloatBuffer{
+		Data:   sig.Samples,
+		Format: &audio.Format{SampleRate: sig.SampleRate, NumChannels: 1},
+	}
+
+	spectrogram, err := fingerprint.GetSpectrogram(buff, s.Options)
+	if err != nil {
+		return err
+	}
+
+	sig.Spectrogram = spectrogram
+	return nil
+}
+
+// Silence marks the frames of Samples that are silent under the config, see
+// fingerprint.SilentFrames. The peak-pick stages skip the silent frames. Levels are relative to the
+// full scale of Audio, or guessed from the Samples if there is no Audio.
+type Silence struct {
+	Config fingerprint.Config
+}
+
+func (Silence) Name() string { return "silence" }
+
+func (s Silence) Process(sig *Signal) error {
+	var fullScale float64
+	if sig.Audio != nil {
+		fullScale = fingerprint.FullScale(sig.Audio)
+	} else {
+		fullScale = fingerprint.FullScale(&audio.FloatBuffer{Data: sig.Samples})
+	}
+
+	sig.Silent = fingerprint.SilentFrames(sig.Samples, fullScale, s.Config)
+	return nil
+}
+
+// Denoise subtracts the noise floor from the Spectrogram in place
+type Denoise struct {
+	Options fingerprint.NoiseOptions
+}
+
+func (Denoise) Name() string { return "denoise" }
+
+func (d Denoise) Process(sig *Signal) error {
+	return fingerprint.SubtractNoise(sig.Spectrogram, d.Options)
+}
+
+// Normalise rescales the Spectrogram in place
+type Normalise struct {
+	Options fingerprint.NormaliseOptions
+}
+
+func (Normalise) Name() string { return "normalise" }
+
+func (n Normalise) Process(sig *Signal) error {
+	return fingerprint.Normalise(sig.Spectrogram, n.Options)
+}
+
+// TopPeaks picks PerSecond tokens for every active second of Samples from the active frames of the
+// whole Spectrogram, see fingerprint.FindPeaks
+type TopPeaks struct {
+	PerSecond float64
+}
+
+func (TopPeaks) Name() string { return "peak-pick" }
+
+func (p TopPeaks) Process(sig *Signal) error {
+	if sig.SampleRate <= 0 {
+		return ErrMissingInput
+	}
+
+	seconds := float64(len(sig.Samples)) / float64(sig.SampleRate) * fingerprint.ActiveFraction(sig.Silent)
+	spectrogram := fingerprint.MaskSilent(sig.Spectrogram, sig.Silent)
+	sig.Tokens = fingerprint.DropSilent(fingerprint.FindPeaks(spectrogram, int(math.Ceil(p.PerSecond*seconds))), sig.Silent)
+	return nil
+}
+
+// WindowPeaks picks TokensPerWindow tokens from the active frames of each block of the Spectrogram,
+// see fingerprint.FindWindowPeaks
+type WindowPeaks struct {
+	TokensPerWindow int
+}
+
+func (WindowPeaks) Name() string { return "peak-pick" }
+
+func (p WindowPeaks) Process(sig *Signal) error {
+	spectrogram := fingerprint.MaskSilent(sig.Spectrogram, sig.Silent)
+	sig.Tokens = fingerprint.DropSilent(fingerprint.FindWindowPeaks(spectrogram, p.TokensPerWindow), sig.Silent)
+	return nil
+}
+
+// LocalPeaks picks the loudest 2D local peaks of each segment and band of the Spectrogram, see
+// fingerprint.FindLocalPeaks and fingerprint.SelectPeaks
+type LocalPeaks struct {
+	Options fingerprint.PeakOptions
+	Density fingerprint.DensityOptions
+}
+
+func (LocalPeaks) Name() string { return "peak-pick" }
+
+func (p LocalPeaks) Process(sig *Signal) error {
+	peaks := fingerprint.DropSilent(fingerprint.FindLocalPeaks(sig.Spectrogram, p.Options), sig.Silent)
+	sig.Tokens = fingerprint.SelectPeaks(peaks, p.Density)
+	return nil
+}
+
+// Hash pairs the Tokens within Zone into the Fingerprint, counting its frames and silent frames
+type Hash struct {
+	Zone fingerprint.TargetZone
+}
+
+func (Hash) Name() string { return "hash" }
+
+func (h Hash) Process(sig *Signal) error {
+	sig.Fingerprint = fingerprint.Fingerprint{
+		Tokens: sig.Tokens,
+		Hashes: fingerprint.PairTokens(sig.Tokens, h.Zone),
+		Frames: len(sig.Spectrogram),
+	}
+	for _, silent := range sig.Silent {
+		if silent {
+			sig.Fingerprint.Silent++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package fingerprint
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/go-audio/audio"
+)
+
+var (
+	ErrAudioTooShort = errors.New("audio too short to fingerprint")
+	ErrNoSampleRate  = errors.New("audio has no sample rate")
+)
+
+func init() {
+	Register("global", func(cfg Config) Fingerprinter { return globalPeaks{cfg} })
+	Register("windowed", func(cfg Config) Fingerprinter { return windowedPeaks{cfg} })
+	Register("landmark", func(cfg Config) Fingerprinter { return landmarks{cfg} })
+	Register("quad", func(cfg Config) Fingerprinter { return quads{cfg} })
+	Register("philips", func(cfg Config) Fingerprinter { return subFingerprints{cfg} })
+	Register("melody", func(cfg Config) Fingerprinter { return melodies{cfg} })
+}
+
+// prepareAudio converts the audio to mono at the config's sample rate, filters it and makes sure
+// there is enough of it to fingerprint
+func prepareAudio(audioBuff audio.Buffer, cfg Config) (*audio.FloatBuffer, error) {
+	buff, err := Preprocess(audioBuff, cfg.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter := NewAudioFilter(cfg.Filter, cfg.SampleRate); filter != nil {
+		buff.Data = filter.Process(buff.Data)
+	}
+
+	if buff.NumFrames() < cfg.WindowSize() {
+		return nil, ErrAudioTooShort
+	}
+
+	return buff, nil
+}
+
+// globalPeaks pairs the loudest frequency-local peaks over the whole audio (GetFingerPrint) that
+// aren't in silent frames
+type globalPeaks struct {
+	cfg Config
+}
+
+func (g globalPeaks) Fingerprint(audioBuff audio.Buffer) (Fingerprint, error) {
+	buff, err := prepareAudio(audioBuff, g.cfg)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	spectrogram, err := GetSpectrogram(buff, g.cfg.SpectrogramOptions())
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	// only the active seconds are given peaks, and only active frames can have them
+	silent := SilentFrames(buff.Data, FullScale(audioBuff), g.cfg)
+	seconds := float64(buff.NumFrames()) / float64(g.cfg.SampleRate) * ActiveFraction(silent)
+	hashTopN := int(math.Ceil(g.cfg.PeaksPerSecond * seconds))
+	tokens := DropSilent(FindPeaks(MaskSilent(spectrogram, silent), hashTopN), silent)
+
+	return Fingerprint{
+		Tokens: tokens,
+		Hashes: PairTokens(tokens, g.cfg.TargetZone()),
+		Frames: len(silent),
+		Silent: countSilent(silent),
+	}, nil
+}
+
+func (g globalPeaks) Algorithm() Algorithm { return Algorithm{Name: "global", Version: 1} }
+
+func (g globalPeaks) Config() Config { return g.cfg }
+
+func (g globalPeaks) RescaleHash(hash TokenPairHash, factor float64) (TokenPairHash, float64) {
+	return rescaleTokenPairHash(g.cfg, hash, factor)
+}
+
+// WindowTokens is the number of tokens FindWindowPeaks must take from each block of 10 frames by 200
+// bins to give the config's peak density
+func WindowTokens(cfg Config) (int, error) {
+	freqWindows := cfg.NumBins() / 200
+	if freqWindows == 0 {
+		return 0, fmt.Errorf("%w: windowed algorithm needs at least 200 frequency bins", ErrInvalidConfig)
+	}
+
+	return max(1, int(math.Round(cfg.PeaksPerSecond*10*cfg.FrameSeconds()/float64(freqWindows)))), nil
+}
+
+// windowedPeaks pairs the loudest cells of each block of the spectrogram (GetFingerPrint2) that
+// aren't in silent frames
+type windowedPeaks struct {
+	cfg Config
+}
+
+func (w windowedPeaks) Fingerprint(audioBuff audio.Buffer) (Fingerprint, error) {
+	buff, err := prepareAudio(audioBuff, w.cfg)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	tokensPerWindow, err := WindowTokens(w.cfg)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	spectrogram, err := GetSpectrogram(buff, w.cfg.SpectrogramOptions())
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	// windows that are partly silent take their tokens from their active frames
+	silent := SilentFrames(buff.Data, FullScale(audioBuff), w.cfg)
+	tokens := DropSilent(FindWindowPeaks(MaskSilent(spectrogram, silent), tokensPerWindow), silent)
+
+	return Fingerprint{
+		Tokens: tokens,
+		Hashes: PairTokens(tokens, w.cfg.TargetZone()),
+		Frames: len(silent),
+		Silent: countSilent(silent),
+	}, nil
+}
+
+func (w windowedPeaks) Algorithm() Algorithm { return Algorithm{Name: "windowed", Version: 1} }
+
+func (w windowedPeaks) Config() Config { return w.cfg }
+
+func (w windowedPeaks) RescaleHash(hash TokenPairHash, factor float64) (TokenPairHash, float64) {
+	return rescaleTokenPairHash(w.cfg, hash, factor)
+}
+
+// landmarks pairs the loudest 2D local peaks of the spectrogram (FindLocalPeaks) in each second and
+// frequency band (SelectPeaks)
+type landmarks struct {
+	cfg Config
+}
+
+func (l landmarks) Fingerprint(audioBuff audio.Buffer) (Fingerprint, error) {
+	buff, err := prepareAudio(audioBuff, l.cfg)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	spectrogram, err := GetSpectrogram(buff, l.cfg.SpectrogramOptions())
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	silent := SilentFrames(buff.Data, FullScale(audioBuff), l.cfg)
+	tokens := SelectPeaks(DropSilent(FindLocalPeaks(spectrogram, l.cfg.PeakOptions()), silent), l.cfg.DensityOptions())
+
+	return Fingerprint{
+		Tokens: tokens,
+		Hashes: PairTokens(tokens, l.cfg.TargetZone()),
+		Frames: len(silent),
+		Silent: countSilent(silent),
+	}, nil
+}
+
+func (l landmarks) Algorithm() Algorithm { return Algorithm{Name: "landmark", Version: 2} }
+
+func (l landmarks) Config() Config { return l.cfg }
+
+func (l landmarks) RescaleHash(hash TokenPairHash, factor float64) (TokenPairHash, float64) {
+	return rescaleTokenPairHash(l.cfg, hash, factor)
+}
+
+// quads hashes the same peaks as landmarks in groups of four (QuadTokens), giving hashes that are
+// the same whether the audio is sped up, slowed down or shifted in pitch
+type quads struct {
+	cfg Config
+}
+
+func (q quads) Fingerprint(audioBuff audio.Buffer) (Fingerprint, error) {
+	buff, err := prepareAudio(audioBuff, q.cfg)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	spectrogram, err := GetSpectrogram(buff, q.cfg.SpectrogramOptions())
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	silent := SilentFrames(buff.Data, FullScale(audioBuff), q.cfg)
+	tokens := SelectPeaks(DropSilent(FindLocalPeaks(spectrogram, q.cfg.PeakOptions()), silent), q.cfg.DensityOptions())
+
+	return Fingerprint{
+		Tokens: tokens,
+		Hashes: QuadTokens(tokens, q.cfg.TargetZone()),
+		Frames: len(silent),
+		Silent: countSilent(silent),
+	}, nil
+}
+
+func (q quads) Algorithm() Algorithm { return Algorithm{Name: "quad", Version: 1} }
+
+func (q quads) Config() Config { return q.cfg }
+
+// subFingerprints hashes every frame into a 32 bit sub-fingerprint of its band energies
+// (SubFingerprints). It needs bins a few Hz apart, such as the philips preset's.
+type subFingerprints struct {
+	cfg Config
+}
+
+func (s subFingerprints) Fingerprint(audioBuff audio.Buffer) (Fingerprint, error) {
+	edges, err := SubFingerprintBands(s.cfg)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	buff, err := prepareAudio(audioBuff, s.cfg)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	// band energies are compared between frames, so the frames must not be rescaled
+	opts := s.cfg.SpectrogramOptions()
+	opts.Magnitude, opts.Normalisation = LinearMagnitude, NoNormalisation
+
+	spectrogram, err := GetSpectrogram(buff, opts)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	res := SubFingerprints(spectrogram, edges)
+
+	silent := SilentFrames(buff.Data, FullScale(audioBuff), s.cfg)
+	res.Frames, res.Silent = len(silent), countSilent(silent)
+	return res, nil
+}
+
+func (s subFingerprints) Algorithm() Algorithm { return Algorithm{Name: "philips", Version: 1} }
+
+func (s subFingerprints) Config() Config { return s.cfg }
+
+func (s subFingerprints) SubFingerprintBits() int { return SubFingerprintBits }
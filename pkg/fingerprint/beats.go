@@ -0,0 +1,148 @@
+package fingerprint
+
+import "math"
+
+// Beats are tracked with Ellis' dynamic programming beat tracker from "Beat Tracking by Dynamic
+// Programming". The tempo is the period the onset strength envelope correlates with best, favouring
+// tempos near 120 BPM, and the beats are the frames that best trade off landing on strong onsets
+// against keeping to that period.
+const (
+	beatMinBPM = 40
+	beatMaxBPM = 240
+
+	// beatPreferredSeconds and beatPreferredOctaves centre and spread the tempo prior, so
+	// the tracker doesn't lock onto double or half the tempo a listener would tap along to
+	beatPreferredSeconds = 0.5
+	beatPreferredOctaves = 1
+
+	// beatTightness is how strongly beats are kept to the tempo rather than onsets
+	beatTightness = 100
+
+	// onsetRangeDecibels is how far below the loudest bin of the spectrogram magnitudes are floored
+	// before taking their rise, so a bin's noise floor doesn't look like an onset
+	onsetRangeDecibels = 80
+)
+
+// OnsetStrength is the spectral flux of each frame of the spectrogram computed with the config, the
+// sum of the rise in log magnitude of its bins since the previous frame. It peaks where notes start.
+func OnsetStrength(spectrogram Spectrogram, cfg Config) []float64 {
+	bins := 0
+	if len(spectrogram) > 0 {
+		bins = min(cfg.spectrumBins(), len(spectrogram[0]))
+	}
+
+	decibels := make([][]float64, len(spectrogram))
+	peak := math.Inf(-1)
+	for t, frame := range spectrogram {
+		decibels[t] = append([]float64(nil), frame[:bins]...)
+		if cfg.Magnitude != DecibelMagnitude {
+			toDecibels(decibels[t])
+		}
+		peak = max(peak, maxFloat(decibels[t]))
+	}
+
+	res := make([]float64, len(spectrogram))
+	for t := 1; t < len(decibels); t++ {
+		for b, level := range decibels[t] {
+			res[t] += max(0, max(level, peak-onsetRangeDecibels)-max(decibels[t-1][b], peak-onsetRangeDecibels))
+		}
+	}
+	return res
+}
+
+// TrackBeats finds the frames the beats of an onset strength envelope fall on, given the time
+// between its frames in seconds. It returns no beats if the envelope is too short to find the tempo
+// in, or has no onsets.
+func TrackBeats(onsets []float64, frameSeconds float64) []int {
+	envelope := standardised(onsets)
+	if envelope == nil {
+		return nil
+	}
+
+	period := beatPeriod(envelope, frameSeconds)
+	if period == 0 {
+		return nil
+	}
+
+	// score[t] is the best total of onsets and tempo penalties of any beats ending with one at t
+	score := make([]float64, len(envelope))
+	prev := make([]int, len(envelope))
+	for t, onset := range envelope {
+		score[t], prev[t] = onset, -1
+
+		best := math.Inf(-1)
+		for tau := max(0, t-2*period); tau <= t-max(1, period/2); tau++ {
+			penalty := math.Log(float64(t-tau) / float64(period))
+			if s := score[tau] - beatTightness*penalty*penalty; s > best {
+				best, prev[t] = s, tau
+			}
+		}
+		if prev[t] >= 0 {
+			score[t] += best
+		}
+	}
+
+	// the last beat is the best scoring frame of the last period
+	last := len(score) - 1
+	for t := max(0, len(score)-period); t < len(score); t++ {
+		if score[t] > score[last] {
+			last = t
+		}
+	}
+
+	var beats []int
+	for t := last; t >= 0; t = prev[t] {
+		beats = append(beats, t)
+	}
+	for i, j := 0, len(beats)-1; i < j; i, j = i+1, j-1 {
+		beats[i], beats[j] = beats[j], beats[i]
+	}
+	return beats
+}
+
+// beatPeriod is the number of frames between beats the envelope's autocorrelation, weighted by the
+// tempo prior, peaks at, or 0 if no period fits in the envelope twice
+func beatPeriod(envelope []float64, frameSeconds float64) int {
+	minLag := max(1, int(math.Round(60.0/beatMaxBPM/frameSeconds)))
+	maxLag := min(len(envelope)/2, int(math.Round(60.0/beatMinBPM/frameSeconds)))
+
+	period, best := 0, 0.0
+	for lag := minLag; lag <= maxLag; lag++ {
+		corr := 0.0
+		for t := lag; t < len(envelope); t++ {
+			corr += envelope[t] * envelope[t-lag]
+		}
+
+		octaves := math.Log2(float64(lag) * frameSeconds / beatPreferredSeconds)
+		if weighted := corr * math.Exp(-octaves*octaves/(2*beatPreferredOctaves*beatPreferredOctaves)); weighted > best {
+			period, best = lag, weighted
+		}
+	}
+	return period
+}
+
+// standardised scales the values to zero mean and unit variance, or returns nil if they are constant
+func standardised(values []float64) []float64 {
+	if len(values) == 0 {
+		return nil
+	}
+
+	mean, variance := 0.0, 0.0
+	for _, x := range values {
+		mean += x
+	}
+	mean /= float64(len(values))
+	for _, x := range values {
+		variance += (x - mean) * (x - mean)
+	}
+	variance /= float64(len(values))
+	if variance == 0 {
+		return nil
+	}
+
+	res := make([]float64, len(values))
+	for i, x := range values {
+		res[i] = (x - mean) / math.Sqrt(variance)
+	}
+	return res
+}
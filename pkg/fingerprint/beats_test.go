@@ -0,0 +1,57 @@
+package fingerprint
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+// clickTrack is seconds of short noise bursts at the tempo
+func clickTrack(bpm, seconds float64, sampleRate int) *audio.FloatBuffer {
+	data := make([]float64, int(seconds*float64(sampleRate)))
+	clickLength := sampleRate / 100
+	for beat := 0.0; ; beat++ {
+		start := int(beat * 60 / bpm * float64(sampleRate))
+		if start >= len(data) {
+			break
+		}
+		for i := start; i < min(len(data), start+clickLength); i++ {
+			// a decaying burst with energy across the spectrum
+			data[i] = 10000 * math.Exp(-float64(i-start)/float64(clickLength)*4) * math.Sin(float64(i)*float64(i))
+		}
+	}
+	return &audio.FloatBuffer{Data: data, Format: &audio.Format{SampleRate: sampleRate, NumChannels: 1}}
+}
+
+func TestTrackBeats(t *testing.T) {
+	cfg, _ := Preset("chroma")
+
+	for _, bpm := range []float64{45, 120, 200} {
+		buff := clickTrack(bpm, 30, cfg.SampleRate)
+		spectrogram, err := GetSpectrogram(buff, cfg.SpectrogramOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		beats := TrackBeats(OnsetStrength(spectrogram, cfg), cfg.FrameSeconds())
+		if len(beats) < 3 {
+			t.Errorf("%v BPM: tracked %d beats", bpm, len(beats))
+			continue
+		}
+
+		intervals := make([]float64, len(beats)-1)
+		for i := range intervals {
+			intervals[i] = cfg.FramesToSeconds(beats[i+1] - beats[i])
+		}
+		sort.Float64s(intervals)
+		interval := intervals[len(intervals)/2]
+
+		// the tracker favours tempos near 120 BPM, so it may tap along at half a fast tempo
+		period := 60 / bpm
+		if math.Abs(interval-period) > cfg.FrameSeconds() && math.Abs(interval-2*period) > cfg.FrameSeconds() {
+			t.Errorf("%v BPM: median beat interval %.3fs, expected %.3fs", bpm, interval, period)
+		}
+	}
+}
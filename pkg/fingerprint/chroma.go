@@ -0,0 +1,151 @@
+package fingerprint
+
+import (
+	"math"
+
+	"github.com/go-audio/audio"
+)
+
+// Chroma folds the frequency bins of a spectrogram onto the 12 pitch classes of the equal tempered
+// scale, C first. It keeps the harmony and melody of the audio but not the octave or timbre of the
+// notes, so it barely changes when a song is played live, by another band or on other instruments.
+const (
+	PitchClasses = 12
+
+	// chromaMinHz and chromaMaxHz bound the bins folded into chroma. Lower bins are too coarse to
+	// tell neighbouring semitones apart, and higher bins hold more harmonics and percussion than
+	// notes.
+	chromaMinHz = 55
+	chromaMaxHz = 4000
+
+	// chromaRefHz is the frequency of C0
+	chromaRefHz = 16.351597831287414
+)
+
+// ChromaVector is the energy of each pitch class, scaled so the largest is 1
+type ChromaVector [PitchClasses]float64
+
+// Chromagram is the chroma vector of each frame of a spectrogram
+type Chromagram []ChromaVector
+
+// Rotate transposes the vector up by semitones
+func (v ChromaVector) Rotate(semitones int) ChromaVector {
+	var res ChromaVector
+	for pc, x := range v {
+		res[(pc+semitones%PitchClasses+PitchClasses)%PitchClasses] = x
+	}
+	return res
+}
+
+// PitchClass is the pitch class nearest hz, 0 for C up to 11 for B
+func PitchClass(hz float64) int {
+	semitones := int(math.Round(12 * math.Log2(hz/chromaRefHz)))
+	return (semitones%PitchClasses + PitchClasses) % PitchClasses
+}
+
+// GetChromagram sums the energy of the spectrogram's bins into pitch classes, frame by frame. The
+// spectrogram must have been computed with the config. Bins are assigned to the pitch class nearest
+// their centre, so the log scale with a band per semitone gives the cleanest chroma, see the chroma
+// preset. Silent frames have a chroma vector of zeros.
+func GetChromagram(spectrogram Spectrogram, cfg Config) Chromagram {
+	if len(spectrogram) == 0 {
+		return nil
+	}
+
+	bins := min(cfg.spectrumBins(), len(spectrogram[0]))
+
+	classes := make([]int, bins)
+	for b := range classes {
+		hz := cfg.BinFrequency(float64(b))
+		if hz < chromaMinHz || hz > chromaMaxHz {
+			classes[b] = -1
+		} else {
+			classes[b] = PitchClass(hz)
+		}
+	}
+
+	res := make(Chromagram, len(spectrogram))
+	for t, frame := range spectrogram {
+		for b, pc := range classes {
+			if pc < 0 {
+				continue
+			}
+
+			mag := frame[b]
+			if cfg.Magnitude == DecibelMagnitude {
+				mag = math.Pow(10, mag/20)
+			}
+			res[t][pc] += mag * mag
+		}
+		res[t] = res[t].normalised()
+	}
+
+	return res
+}
+
+// normalised scales the vector so its largest pitch class is 1
+func (v ChromaVector) normalised() ChromaVector {
+	peak := 0.0
+	for _, x := range v {
+		peak = max(peak, x)
+	}
+	if peak == 0 {
+		return v
+	}
+
+	for pc := range v {
+		v[pc] /= peak
+	}
+	return v
+}
+
+// BeatChroma is the chroma of audio averaged over each beat. Chroma[i] covers the frames from
+// Beats[i] up to the next beat, or to the end of the audio for the last beat. Averaging over beats
+// rather than frames makes the sequence the same length whatever tempo the song is played at.
+type BeatChroma struct {
+	Beats  []int
+	Chroma Chromagram
+}
+
+// GetBeatChroma tracks the beats of the audio and averages its chroma over each of them. The config
+// should be the chroma preset, or similar.
+func GetBeatChroma(audioBuff audio.Buffer, cfg Config) (BeatChroma, error) {
+	buff, err := prepareAudio(audioBuff, cfg)
+	if err != nil {
+		return BeatChroma{}, err
+	}
+
+	opts := cfg.SpectrogramOptions()
+	opts.Normalisation = NoNormalisation
+
+	spectrogram, err := GetSpectrogram(buff, opts)
+	if err != nil {
+		return BeatChroma{}, err
+	}
+
+	beats := TrackBeats(OnsetStrength(spectrogram, cfg), cfg.FrameSeconds())
+	if len(beats) == 0 {
+		return BeatChroma{}, ErrAudioTooShort
+	}
+
+	return BeatChroma{Beats: beats, Chroma: BeatSync(GetChromagram(spectrogram, cfg), beats)}, nil
+}
+
+// BeatSync averages the chromagram over each beat, see BeatChroma
+func BeatSync(chromagram Chromagram, beats []int) Chromagram {
+	res := make(Chromagram, len(beats))
+	for i, start := range beats {
+		end := len(chromagram)
+		if i+1 < len(beats) {
+			end = beats[i+1]
+		}
+
+		for _, v := range chromagram[min(start, len(chromagram)):min(end, len(chromagram))] {
+			for pc, x := range v {
+				res[i][pc] += x
+			}
+		}
+		res[i] = res[i].normalised()
+	}
+	return res
+}
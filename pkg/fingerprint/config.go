@@ -0,0 +1,462 @@
+package fingerprint
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidConfig = errors.New("invalid fingerprint config")
+
+// Config describes how audio is fingerprinted in physical units, independent of any algorithm.
+// Ingest and query must use the same Config for their hashes to match.
+type Config struct {
+	// SampleRate is the rate in Hz audio is resampled to and analysed at
+	SampleRate int `json:"sample_rate" yaml:"sample_rate"`
+	// WindowMs is the length of each spectrogram frame and HopMs the step between frames
+	WindowMs float64 `json:"window_ms" yaml:"window_ms"`
+	HopMs    float64 `json:"hop_ms" yaml:"hop_ms"`
+	// Window is applied to each frame, KaiserBeta shapes the Kaiser window
+	Window     Window  `json:"window" yaml:"window"`
+	KaiserBeta float64 `json:"kaiser_beta,omitempty" yaml:"kaiser_beta,omitempty"`
+	// Scale, Bands, MinHz and MaxHz choose the spectrogram's frequency bins, see SpectrogramOptions
+	Scale FrequencyScale `json:"scale,omitempty" yaml:"scale,omitempty"`
+	Bands int            `json:"bands,omitempty" yaml:"bands,omitempty"`
+	MinHz float64        `json:"min_hz,omitempty" yaml:"min_hz,omitempty"`
+	MaxHz float64        `json:"max_hz,omitempty" yaml:"max_hz,omitempty"`
+	// Magnitude chooses between linear and decibel spectrogram magnitudes
+	Magnitude MagnitudeScale `json:"magnitude,omitempty" yaml:"magnitude,omitempty"`
+	// Filter band limits and pre-emphasises the audio, and Noise subtracts its noise floor from the
+	// spectrogram before normalisation
+	Filter FilterConfig `json:"filter" yaml:"filter"`
+	Noise  NoiseConfig  `json:"noise" yaml:"noise"`
+	// Silence marks quiet frames that peaks aren't picked from
+	Silence SilenceConfig `json:"silence" yaml:"silence"`
+	// Normalisation rescales the spectrogram, averaging over NormaliseMs where the strategy needs it
+	Normalisation Normalisation `json:"normalisation,omitempty" yaml:"normalisation,omitempty"`
+	NormaliseMs   float64       `json:"normalise_ms,omitempty" yaml:"normalise_ms,omitempty"`
+	// PeaksPerSecond is the number of peak tokens to aim for per second of audio, shared evenly
+	// between PeakBands frequency bands by the algorithms that control peak density
+	PeaksPerSecond float64    `json:"peaks_per_second" yaml:"peaks_per_second"`
+	PeakBands      int        `json:"peak_bands,omitempty" yaml:"peak_bands,omitempty"`
+	Peaks          PeakConfig `json:"peaks" yaml:"peaks"`
+	Zone           ZoneConfig `json:"zone" yaml:"zone"`
+}
+
+// PeakConfig is the neighbourhood local peaks are picked from, see PeakOptions
+type PeakConfig struct {
+	TimeRadiusMs        float64 `json:"time_radius_ms" yaml:"time_radius_ms"`
+	FreqRadiusHz        float64 `json:"freq_radius_hz" yaml:"freq_radius_hz"`
+	ThresholdDeviations float64 `json:"threshold_deviations" yaml:"threshold_deviations"`
+}
+
+// ZoneConfig is the target zone each anchor token is paired within, see TargetZone
+type ZoneConfig struct {
+	MinDeltaMs float64 `json:"min_delta_ms" yaml:"min_delta_ms"`
+	MaxDeltaMs float64 `json:"max_delta_ms" yaml:"max_delta_ms"`
+	MaxDeltaHz float64 `json:"max_delta_hz" yaml:"max_delta_hz"`
+	FanOut     int     `json:"fan_out" yaml:"fan_out"`
+}
+
+var presets = map[string]Config{
+	// default keeps the frame sizes gozam has always been run with
+	"default": {
+		SampleRate:     44100,
+		WindowMs:       100,
+		HopMs:          75,
+		Window:         Hann,
+		PeaksPerSecond: 16,
+		PeakBands:      4,
+		Peaks:          PeakConfig{TimeRadiusMs: 150, FreqRadiusHz: 250, ThresholdDeviations: 1},
+		Zone:           ZoneConfig{MinDeltaMs: 75, MaxDeltaMs: 1875, MaxDeltaHz: 10000, FanOut: 10},
+	},
+	// fast trades accuracy for fewer frames, peaks and hashes
+	"fast": {
+		SampleRate:     11025,
+		WindowMs:       100,
+		HopMs:          100,
+		Window:         Hann,
+		PeaksPerSecond: 8,
+		PeakBands:      2,
+		Peaks:          PeakConfig{TimeRadiusMs: 200, FreqRadiusHz: 300, ThresholdDeviations: 1},
+		Zone:           ZoneConfig{MinDeltaMs: 100, MaxDeltaMs: 1500, MaxDeltaHz: 2000, FanOut: 5},
+	},
+	// robust uses more overlap, peaks and pairs to survive noisy queries, and picks peaks relative
+	// to the level of their band
+	"robust": {
+		SampleRate:     22050,
+		WindowMs:       100,
+		HopMs:          50,
+		Window:         Blackman,
+		Magnitude:      DecibelMagnitude,
+		Normalisation:  BandMedian,
+		NormaliseMs:    2000,
+		PeaksPerSecond: 30,
+		PeakBands:      6,
+		Peaks:          PeakConfig{TimeRadiusMs: 150, FreqRadiusHz: 200, ThresholdDeviations: 0.5},
+		Zone:           ZoneConfig{MinDeltaMs: 50, MaxDeltaMs: 2000, MaxDeltaHz: 4000, FanOut: 15},
+	},
+	// noisy is robust with a front end for microphone queries, band limited to 300-5000 Hz where
+	// rumble and hiss are weakest, with the room's noise floor subtracted before peak picking and no
+	// peaks picked from stretches of silence
+	"noisy": {
+		SampleRate:     22050,
+		WindowMs:       100,
+		HopMs:          50,
+		Window:         Blackman,
+		Filter:         FilterConfig{HighPassHz: 300, LowPassHz: 5000, PreEmphasis: 0.97},
+		Noise:          NoiseConfig{Subtraction: 1, Floor: 0.05, WindowMs: 1500},
+		Silence:        SilenceConfig{ThresholdDb: -50, MinMs: 500},
+		Magnitude:      DecibelMagnitude,
+		Normalisation:  BandMedian,
+		NormaliseMs:    2000,
+		PeaksPerSecond: 30,
+		PeakBands:      6,
+		Peaks:          PeakConfig{TimeRadiusMs: 150, FreqRadiusHz: 200, ThresholdDeviations: 0.5},
+		Zone:           ZoneConfig{MinDeltaMs: 50, MaxDeltaMs: 2000, MaxDeltaHz: 4000, FanOut: 15},
+	},
+	// philips uses the long, heavily overlapping frames of the philips sub-fingerprint algorithm,
+	// 2048 samples every 64 samples, whose bins are fine enough for its bands
+	"philips": {
+		SampleRate: 5512,
+		WindowMs:   371.5,
+		HopMs:      11.61,
+		Window:     Hann,
+	},
+	// chroma has a log band per semitone from C2 to B6 for GetChromagram, centred on the notes of
+	// the equal tempered scale, and frames long enough to resolve semitones in the lowest octave
+	"chroma": {
+		SampleRate: 11025,
+		WindowMs:   371.5,
+		HopMs:      46.44,
+		Window:     Hann,
+		Scale:      LogScale,
+		Bands:      60,
+		MinHz:      61.735,
+		MaxHz:      2093.005,
+	},
+	// melody has frames long enough to hold several periods of a low voice for TrackPitch, and log
+	// bands a third of a semitone apart from 80 Hz to 5 kHz for DominantPitch
+	"melody": {
+		SampleRate: 11025,
+		WindowMs:   92.88,
+		HopMs:      23.22,
+		Window:     Hann,
+		Scale:      LogScale,
+		Bands:      215,
+		MinHz:      80,
+		MaxHz:      5000,
+	},
+}
+
+// Preset returns the named preset config
+func Preset(name string) (Config, bool) {
+	cfg, ok := presets[name]
+	return cfg, ok
+}
+
+// Presets lists the names of the preset configs in sorted order
+func Presets() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveConfig returns the named preset, or loads the config file at nameOrPath if there is no
+// preset of that name, see LoadConfig
+func ResolveConfig(nameOrPath string) (Config, error) {
+	if cfg, ok := Preset(nameOrPath); ok {
+		return cfg, nil
+	}
+	return LoadConfig(nameOrPath)
+}
+
+// LoadConfig reads a JSON or YAML config file, chosen by its extension. Fields missing from the file
+// are taken from the default preset. The config is validated before it is returned.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg := presets["default"]
+	switch filepath.Ext(path) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&cfg)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&cfg)
+	default:
+		return Config{}, fmt.Errorf("unsupported config file type '%s'", filepath.Ext(path))
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse config '%s': %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every nonsensical setting in the config
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidConfig}, args...)...))
+	}
+
+	if c.SampleRate <= 0 {
+		invalid("sample_rate must be positive, got %d", c.SampleRate)
+	}
+	if c.WindowMs <= 0 || c.HopMs <= 0 {
+		invalid("window_ms and hop_ms must be positive, got %v and %v", c.WindowMs, c.HopMs)
+	} else if c.HopMs > c.WindowMs {
+		invalid("hop_ms (%v) must not exceed window_ms (%v) or audio between frames is skipped", c.HopMs, c.WindowMs)
+	}
+	if c.SampleRate > 0 && c.WindowMs > 0 && c.WindowSize() < 2*magAveragingWindowSize {
+		invalid("window_ms (%v) is only %d samples at %d Hz", c.WindowMs, c.WindowSize(), c.SampleRate)
+	}
+	if c.SampleRate > 0 && c.HopMs > 0 && c.HopSize() < 1 {
+		invalid("hop_ms (%v) is less than one sample at %d Hz", c.HopMs, c.SampleRate)
+	}
+	if _, err := c.Window.Coefficients(1, c.KaiserBeta); err != nil {
+		invalid("%v", err)
+	} else if c.Window == Kaiser && c.KaiserBeta < 0 {
+		invalid("kaiser_beta must not be negative, got %v", c.KaiserBeta)
+	}
+	if err := c.Scale.validate(); err != nil {
+		invalid("%v", err)
+	} else if c.Scale == MelScale || c.Scale == LogScale {
+		if c.Bands <= 0 {
+			invalid("%s scale needs a positive number of bands, got %d", c.Scale, c.Bands)
+		}
+		if c.MinHz < 0 || (c.Scale == LogScale && c.MinHz == 0) {
+			invalid("min_hz (%v) must be positive for the %s scale", c.MinHz, c.Scale)
+		}
+		if c.SampleRate > 0 && (c.MaxHz < 0 || c.MaxHz > float64(c.SampleRate)/2) {
+			invalid("max_hz (%v) must be between 0 and the nyquist frequency (%v)", c.MaxHz, float64(c.SampleRate)/2)
+		} else if c.SampleRate > 0 && c.MinHz >= c.maxHz() {
+			invalid("min_hz (%v) must be below max_hz (%v)", c.MinHz, c.maxHz())
+		}
+	}
+	if err := c.Magnitude.validate(); err != nil {
+		invalid("%v", err)
+	}
+	if err := c.Filter.validate(c.SampleRate); err != nil {
+		invalid("%v", err)
+	}
+	if err := c.Noise.validate(c.HopMs); err != nil {
+		invalid("%v", err)
+	}
+	if err := c.Silence.validate(); err != nil {
+		invalid("%v", err)
+	}
+	if err := c.Normalisation.validate(); err != nil {
+		invalid("%v", err)
+	} else if c.Normalisation.usesFrames() && c.HopMs > 0 && c.NormaliseMs < c.HopMs {
+		invalid("%s normalisation needs normalise_ms (%v) of at least a hop (%v ms)", c.Normalisation, c.NormaliseMs, c.HopMs)
+	}
+
+	// the peak and zone settings are left out by algorithms that don't pick peaks
+	if c.PicksPeaks() {
+		if c.PeaksPerSecond <= 0 {
+			invalid("peaks_per_second must be positive, got %v", c.PeaksPerSecond)
+		}
+
+		if c.PeakBands < 0 {
+			invalid("peak_bands must not be negative, got %d", c.PeakBands)
+		} else if c.SampleRate > 0 && c.WindowMs > 0 && c.Scale.validate() == nil && c.PeakBands > c.spectrumBins() {
+			invalid("peak_bands (%d) exceeds the %d frequency bins", c.PeakBands, c.spectrumBins())
+		}
+		if c.Peaks.TimeRadiusMs < 0 || c.Peaks.FreqRadiusHz < 0 {
+			invalid("peak time_radius_ms and freq_radius_hz must not be negative, got %v and %v", c.Peaks.TimeRadiusMs, c.Peaks.FreqRadiusHz)
+		}
+
+		if c.Zone.MinDeltaMs < 0 || c.Zone.MaxDeltaMs < c.Zone.MinDeltaMs {
+			invalid("zone must satisfy 0 <= min_delta_ms <= max_delta_ms, got %v and %v", c.Zone.MinDeltaMs, c.Zone.MaxDeltaMs)
+		} else if c.HopMs > 0 && c.Zone.MaxDeltaMs < c.HopMs {
+			invalid("zone max_delta_ms (%v) is shorter than a single hop (%v ms)", c.Zone.MaxDeltaMs, c.HopMs)
+		}
+		if c.Zone.MaxDeltaHz <= 0 {
+			invalid("zone max_delta_hz must be positive, got %v", c.Zone.MaxDeltaHz)
+		}
+		if c.Zone.FanOut <= 0 {
+			invalid("zone fan_out must be positive, got %d", c.Zone.FanOut)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// PicksPeaks reports whether the config has any peak or zone settings, which every algorithm that
+// picks and pairs peaks needs and the others leave out
+func (c Config) PicksPeaks() bool {
+	return c.PeaksPerSecond != 0 || c.PeakBands != 0 || c.Peaks != (PeakConfig{}) || c.Zone != (ZoneConfig{})
+}
+
+// WindowSize is the length of a spectrogram frame in samples
+func (c Config) WindowSize() int {
+	return int(math.Round(c.WindowMs * float64(c.SampleRate) / 1000))
+}
+
+// HopSize is the step between spectrogram frames in samples
+func (c Config) HopSize() int {
+	return int(math.Round(c.HopMs * float64(c.SampleRate) / 1000))
+}
+
+// SpectrogramOptions converts the frame config into samples
+func (c Config) SpectrogramOptions() SpectrogramOptions {
+	return SpectrogramOptions{
+		BinSize:    c.WindowSize(),
+		Overlap:    c.WindowSize() - c.HopSize(),
+		Window:     c.Window,
+		KaiserBeta: c.KaiserBeta,
+		Scale:      c.Scale,
+		Bands:      c.Bands,
+		MinHz:      c.MinHz,
+		MaxHz:      c.MaxHz,
+		Magnitude:  c.Magnitude,
+
+		NoiseSubtraction: c.Noise.Subtraction,
+		NoiseFloor:       c.Noise.Floor,
+		NoiseFrames:      int(math.Round(c.Noise.WindowMs / (c.FrameSeconds() * 1000))),
+
+		Normalisation:   c.Normalisation,
+		NormaliseFrames: int(math.Round(c.NormaliseMs / (c.FrameSeconds() * 1000))),
+	}
+}
+
+// NormaliseOptions are the options the spectrogram is normalised with
+func (c Config) NormaliseOptions() NormaliseOptions {
+	return c.SpectrogramOptions().normaliseOptions()
+}
+
+// NoiseOptions are the options the noise floor is subtracted with
+func (c Config) NoiseOptions() NoiseOptions {
+	return c.SpectrogramOptions().noiseOptions()
+}
+
+// NumBins is the number of frequency bins in each spectrogram frame
+func (c Config) NumBins() int {
+	if c.Scale == MelScale || c.Scale == LogScale {
+		return c.Bands
+	}
+	return c.WindowSize()/magAveragingWindowSize + 1
+}
+
+// spectrumBins is the number of frequency bins below the nyquist frequency. The linear scale keeps
+// the mirror image of the spectrum above it.
+func (c Config) spectrumBins() int {
+	if c.Scale == MelScale || c.Scale == LogScale {
+		return c.Bands
+	}
+	return (c.WindowSize()/2)/magAveragingWindowSize + 1
+}
+
+// maxHz is the top of the mel and log scales
+func (c Config) maxHz() float64 {
+	if c.MaxHz == 0 {
+		return float64(c.SampleRate) / 2
+	}
+	return c.MaxHz
+}
+
+// FreqBinHz is the width of a spectrogram frequency bin in Hz. The bins of the mel and log scales
+// are not evenly spaced in Hz, so this is their average spacing.
+func (c Config) FreqBinHz() float64 {
+	if c.Scale == MelScale || c.Scale == LogScale {
+		return (c.maxHz() - c.MinHz) / float64(c.Bands+1)
+	}
+	return float64(c.SampleRate) / float64(c.WindowSize()) * magAveragingWindowSize
+}
+
+// BinFrequency is the centre frequency in Hz of a spectrogram frequency bin. Fractional bins are
+// interpolated along the scale.
+func (c Config) BinFrequency(bin float64) float64 {
+	switch c.Scale {
+	case MelScale:
+		lo, hi := hzToMel(c.MinHz), hzToMel(c.maxHz())
+		return melToHz(lo + (hi-lo)*(bin+1)/float64(c.Bands+1))
+	case LogScale:
+		lo, hi := math.Log2(c.MinHz), math.Log2(c.maxHz())
+		return math.Pow(2, lo+(hi-lo)*(bin+1)/float64(c.Bands+1))
+	default:
+		return bin * c.FreqBinHz()
+	}
+}
+
+// FrequencyBin is the inverse of BinFrequency, the fractional spectrogram bin centred on hz
+func (c Config) FrequencyBin(hz float64) float64 {
+	switch c.Scale {
+	case MelScale:
+		lo, hi := hzToMel(c.MinHz), hzToMel(c.maxHz())
+		return (hzToMel(hz)-lo)/(hi-lo)*float64(c.Bands+1) - 1
+	case LogScale:
+		lo, hi := math.Log2(c.MinHz), math.Log2(c.maxHz())
+		return (math.Log2(hz)-lo)/(hi-lo)*float64(c.Bands+1) - 1
+	default:
+		return hz / c.FreqBinHz()
+	}
+}
+
+// FrameSeconds is the time between spectrogram frames in seconds
+func (c Config) FrameSeconds() float64 {
+	return float64(c.HopSize()) / float64(c.SampleRate)
+}
+
+// FramesToSeconds converts a number of spectrogram frames, such as the time of a token, into seconds
+func (c Config) FramesToSeconds(frames int) float64 {
+	return float64(frames) * c.FrameSeconds()
+}
+
+// PeakOptions converts the peak neighbourhood into spectrogram frames and bins
+func (c Config) PeakOptions() PeakOptions {
+	return PeakOptions{
+		TimeRadius:          int(math.Round(c.Peaks.TimeRadiusMs / (c.FrameSeconds() * 1000))),
+		FreqRadius:          int(math.Round(c.Peaks.FreqRadiusHz / c.FreqBinHz())),
+		ThresholdDeviations: c.Peaks.ThresholdDeviations,
+	}
+}
+
+// DensityOptions converts the peak density into one second segments and evenly spaced bands
+// below the nyquist frequency
+func (c Config) DensityOptions() DensityOptions {
+	bands := max(1, c.PeakBands)
+	segmentFrames := max(1, int(math.Round(1/c.FrameSeconds())))
+
+	edges := make([]int, bands+1)
+	for i := range edges {
+		edges[i] = i * c.spectrumBins() / bands
+	}
+
+	return DensityOptions{
+		SegmentFrames: segmentFrames,
+		BandEdges:     edges,
+		PerBand:       int(math.Ceil(c.PeaksPerSecond * float64(segmentFrames) * c.FrameSeconds() / float64(bands))),
+	}
+}
+
+// TargetZone converts the zone config into spectrogram frames and bins
+func (c Config) TargetZone() TargetZone {
+	hop := c.FrameSeconds() * 1000
+	return TargetZone{
+		MinTimeDelta: int(math.Round(c.Zone.MinDeltaMs / hop)),
+		MaxTimeDelta: int(math.Round(c.Zone.MaxDeltaMs / hop)),
+		MaxFreqDelta: int(math.Floor(c.Zone.MaxDeltaHz / c.FreqBinHz())),
+		FanOut:       c.Zone.FanOut,
+	}
+}
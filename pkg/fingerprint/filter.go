@@ -0,0 +1,217 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math"
+)
+
+// Microphone recordings pick up rumble, hum and hiss that put spurious peaks all over the
+// spectrogram. The filters here run before peak picking on both reference audio and queries: a
+// band limiting and pre-emphasis front end on the samples, then spectral subtraction of a noise
+// floor tracked with Martin's minimum statistics, from "Noise Power Spectral Density Estimation Based
+// on Optimal Smoothing and Minimum Statistics".
+const (
+	// noiseSmoothing is the weight a bin's smoothed magnitude gives its newest frame
+	noiseSmoothing = 0.2
+	// noiseBias scales the minimum of the smoothed magnitudes up to the average level of the noise
+	noiseBias = 1.5
+)
+
+// butterworthQ are the Q factors of the two biquads of a 4th order Butterworth filter
+var butterworthQ = [2]float64{0.5411961001461970, 1.3065629648763764}
+
+// FilterConfig band limits and pre-emphasises audio before its spectrogram is taken. A zero field
+// turns its filter off.
+type FilterConfig struct {
+	// HighPassHz removes rumble below it and LowPassHz hiss above it, each with a 4th order
+	// Butterworth filter
+	HighPassHz float64 `json:"high_pass_hz,omitempty" yaml:"high_pass_hz,omitempty"`
+	LowPassHz  float64 `json:"low_pass_hz,omitempty" yaml:"low_pass_hz,omitempty"`
+	// PreEmphasis is the coefficient a of the filter y[n] = x[n] - a*x[n-1], which tilts the spectrum
+	// towards the high frequencies that rumble and room reverberation drown out. 0.97 is typical.
+	PreEmphasis float64 `json:"pre_emphasis,omitempty" yaml:"pre_emphasis,omitempty"`
+}
+
+// NoiseConfig subtracts a tracked estimate of stationary noise from the spectrogram, see
+// NoiseOptions
+type NoiseConfig struct {
+	// Subtraction is how many times the noise estimate is subtracted from each bin, 0 to disable
+	Subtraction float64 `json:"subtraction,omitempty" yaml:"subtraction,omitempty"`
+	// Floor is the fraction of each bin kept however much noise is subtracted
+	Floor float64 `json:"floor,omitempty" yaml:"floor,omitempty"`
+	// WindowMs is how far back the quietest level of each bin is looked for
+	WindowMs float64 `json:"window_ms,omitempty" yaml:"window_ms,omitempty"`
+}
+
+func (f FilterConfig) validate(sampleRate int) error {
+	nyquist := float64(sampleRate) / 2
+
+	switch {
+	case f.HighPassHz < 0 || f.LowPassHz < 0:
+		return fmt.Errorf("filter high_pass_hz and low_pass_hz must not be negative, got %v and %v", f.HighPassHz, f.LowPassHz)
+	case sampleRate > 0 && (f.HighPassHz >= nyquist || f.LowPassHz >= nyquist):
+		return fmt.Errorf("filter high_pass_hz (%v) and low_pass_hz (%v) must be below the nyquist frequency (%v)", f.HighPassHz, f.LowPassHz, nyquist)
+	case f.HighPassHz > 0 && f.LowPassHz > 0 && f.HighPassHz >= f.LowPassHz:
+		return fmt.Errorf("filter high_pass_hz (%v) must be below low_pass_hz (%v)", f.HighPassHz, f.LowPassHz)
+	case f.PreEmphasis < 0 || f.PreEmphasis >= 1:
+		return fmt.Errorf("filter pre_emphasis must be in [0, 1), got %v", f.PreEmphasis)
+	}
+	return nil
+}
+
+func (n NoiseConfig) validate(hopMs float64) error {
+	switch {
+	case n.Subtraction < 0:
+		return fmt.Errorf("noise subtraction must not be negative, got %v", n.Subtraction)
+	case n.Floor < 0 || n.Floor >= 1:
+		return fmt.Errorf("noise floor must be in [0, 1), got %v", n.Floor)
+	case n.Subtraction > 0 && hopMs > 0 && n.WindowMs < hopMs:
+		return fmt.Errorf("noise subtraction needs window_ms (%v) of at least a hop (%v ms)", n.WindowMs, hopMs)
+	}
+	return nil
+}
+
+// biquad is a second order IIR filter section, in direct form I
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// newBiquad is a low or high pass section with cutoff hz and quality q, from Bristow-Johnson's
+// "Audio EQ Cookbook"
+func newBiquad(highPass bool, hz, q float64, sampleRate int) biquad {
+	w0 := 2 * math.Pi * hz / float64(sampleRate)
+	cos, alpha := math.Cos(w0), math.Sin(w0)/(2*q)
+	a0 := 1 + alpha
+
+	b := biquad{a1: -2 * cos / a0, a2: (1 - alpha) / a0}
+	if highPass {
+		b.b0, b.b1, b.b2 = (1+cos)/2/a0, -(1+cos)/a0, (1+cos)/2/a0
+	} else {
+		b.b0, b.b1, b.b2 = (1-cos)/2/a0, (1-cos)/a0, (1-cos)/2/a0
+	}
+	return b
+}
+
+func (b *biquad) process(x float64) float64 {
+	y := b.b0*x + b.b1*b.x1 + b.b2*b.x2 - b.a1*b.y1 - b.a2*b.y2
+	b.x1, b.x2, b.y1, b.y2 = x, b.x1, y, b.y1
+	return y
+}
+
+// AudioFilter applies a FilterConfig to mono audio, carrying its state from one chunk of samples to
+// the next so streamed audio is filtered the same as a whole buffer
+type AudioFilter struct {
+	sections    []biquad
+	preEmphasis float64
+	last        float64
+}
+
+// NewAudioFilter creates a filter for audio at the sample rate, or nil if every filter is off
+func NewAudioFilter(cfg FilterConfig, sampleRate int) *AudioFilter {
+	if cfg == (FilterConfig{}) {
+		return nil
+	}
+
+	f := &AudioFilter{preEmphasis: cfg.PreEmphasis}
+	for _, q := range butterworthQ {
+		if cfg.HighPassHz > 0 {
+			f.sections = append(f.sections, newBiquad(true, cfg.HighPassHz, q, sampleRate))
+		}
+		if cfg.LowPassHz > 0 {
+			f.sections = append(f.sections, newBiquad(false, cfg.LowPassHz, q, sampleRate))
+		}
+	}
+	return f
+}
+
+// Process returns the filtered samples, leaving the samples given untouched
+func (f *AudioFilter) Process(samples []float64) []float64 {
+	res := make([]float64, len(samples))
+	for i, x := range samples {
+		y := x - f.preEmphasis*f.last
+		f.last = x
+
+		for s := range f.sections {
+			y = f.sections[s].process(y)
+		}
+		res[i] = y
+	}
+	return res
+}
+
+// NoiseOptions chooses how much noise SubtractNoise takes out. Each bin's magnitude is smoothed over
+// time, and the quietest smoothed level over the last Frames frames estimates the bin's noise.
+// Subtraction times that estimate is subtracted from the bin, keeping at least Floor of its
+// magnitude. Decibel spectrograms are converted to linear magnitudes to subtract the noise.
+type NoiseOptions struct {
+	Subtraction float64
+	Floor       float64
+	Frames      int
+	Decibels    bool
+}
+
+// SubtractNoise subtracts the tracked noise floor from the spectrogram in place. The estimate only
+// looks back in time, so the frames of a stream can be passed a few at a time to a noiseSuppressor
+// with the same result.
+func SubtractNoise(spectrogram Spectrogram, opts NoiseOptions) error {
+	if opts.Subtraction > 0 && opts.Frames <= 0 {
+		return fmt.Errorf("noise subtraction needs a positive number of frames, got %d", opts.Frames)
+	}
+
+	suppressor := noiseSuppressor{opts: opts}
+	suppressor.write(spectrogram)
+	return nil
+}
+
+// noiseSuppressor subtracts the noise floor from frames as they arrive
+type noiseSuppressor struct {
+	opts NoiseOptions
+
+	smoothed []float64
+	// history holds the smoothed magnitudes of the last Frames frames
+	history Spectrogram
+}
+
+func (n *noiseSuppressor) write(frames Spectrogram) {
+	if n.opts.Subtraction <= 0 {
+		return
+	}
+
+	for _, frame := range frames {
+		mags := frame
+		if n.opts.Decibels {
+			mags = make([]float64, len(frame))
+			for f, level := range frame {
+				mags[f] = math.Pow(10, level/20)
+			}
+		}
+
+		if n.smoothed == nil {
+			n.smoothed = append([]float64(nil), mags...)
+		} else {
+			for f, mag := range mags {
+				n.smoothed[f] += noiseSmoothing * (mag - n.smoothed[f])
+			}
+		}
+
+		if len(n.history) == n.opts.Frames {
+			n.history = append(n.history[:0], n.history[1:]...)
+		}
+		n.history = append(n.history, append([]float64(nil), n.smoothed...))
+
+		for f, mag := range mags {
+			noise := n.smoothed[f]
+			for _, past := range n.history {
+				noise = min(noise, past[f])
+			}
+
+			clean := max(mag-n.opts.Subtraction*noiseBias*noise, n.opts.Floor*mag)
+			if n.opts.Decibels {
+				frame[f] = 20 * math.Log10(max(clean, decibelFloor))
+			} else {
+				frame[f] = clean
+			}
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package fingerprint
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAudioFilterHighPass(t *testing.T) {
+	const sampleRate = 8000
+	filter := FilterConfig{HighPassHz: 300}
+
+	// rms is the level of the filtered tone, after the filter has settled
+	rms := func(hz float64) float64 {
+		samples := make([]float64, 2*sampleRate)
+		for i := range samples {
+			samples[i] = math.Sin(2 * math.Pi * hz * float64(i) / sampleRate)
+		}
+		filtered := NewAudioFilter(filter, sampleRate).Process(samples)[sampleRate:]
+
+		sum := 0.0
+		for _, y := range filtered {
+			sum += y * y
+		}
+		return math.Sqrt(sum / float64(len(filtered)) * 2)
+	}
+
+	// a 4th order filter is down 24 dB per octave below its cutoff
+	if level := rms(50); level > 0.01 {
+		t.Errorf("50 Hz hum kept at %.4f of its level", level)
+	}
+	if level := rms(1000); level < 0.95 || level > 1.05 {
+		t.Errorf("1 kHz tone kept at %.4f of its level", level)
+	}
+}
+
+func TestAudioFilterChunked(t *testing.T) {
+	const sampleRate = 11025
+	cfg := FilterConfig{HighPassHz: 100, LowPassHz: 4000, PreEmphasis: 0.97}
+
+	rng := rand.New(rand.NewSource(5))
+	samples := make([]float64, sampleRate)
+	for i := range samples {
+		samples[i] = 1000 * rng.NormFloat64()
+	}
+
+	whole := NewAudioFilter(cfg, sampleRate).Process(samples)
+
+	filter := NewAudioFilter(cfg, sampleRate)
+	var chunked []float64
+	for start, size := 0, 1; start < len(samples); start, size = start+size, size*3%1000+1 {
+		chunked = append(chunked, filter.Process(samples[start:min(len(samples), start+size)])...)
+	}
+
+	for i := range whole {
+		if whole[i] != chunked[i] {
+			t.Fatalf("sample %d filtered to %v in chunks, %v whole", i, chunked[i], whole[i])
+		}
+	}
+}
+
+func TestSubtractNoiseFloor(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	mags := make(Spectrogram, 50)
+	for n := range mags {
+		mags[n] = make([]float64, 64)
+		for f := range mags[n] {
+			mags[n][f] = 10 * rng.ExpFloat64()
+		}
+	}
+
+	for _, decibels := range []bool{false, true} {
+		opts := NoiseOptions{Subtraction: 4, Floor: 0.1, Frames: 10, Decibels: decibels}
+
+		clean := make(Spectrogram, len(mags))
+		for n, frame := range mags {
+			clean[n] = append([]float64(nil), frame...)
+			if decibels {
+				for f, mag := range frame {
+					clean[n][f] = 20 * math.Log10(mag)
+				}
+			}
+		}
+		if err := SubtractNoise(clean, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		// subtraction takes noise out but never more than 1-Floor of a bin
+		floored := 0
+		for n, frame := range clean {
+			for f, got := range frame {
+				if decibels {
+					got = math.Pow(10, got/20)
+				}
+
+				mag := mags[n][f]
+				if got < opts.Floor*mag*(1-1e-9) || got > mag*(1+1e-9) {
+					t.Fatalf("decibels %v: frame %d bin %d of %.3f subtracted to %.3f", decibels, n, f, mag, got)
+				}
+				if got <= opts.Floor*mag*(1+1e-9) {
+					floored++
+				}
+			}
+		}
+		if floored == 0 {
+			t.Errorf("decibels %v: no bin was subtracted down to the floor", decibels)
+		}
+	}
+}
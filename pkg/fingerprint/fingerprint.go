@@ -3,7 +3,6 @@ package fingerprint
 
 import (
 	"container/heap"
-	"fmt"
 
 	"github.com/go-audio/audio"
 )
@@ -13,8 +12,6 @@ type Token struct {
 	Amp        float64
 }
 
-type TokenPairHash int64
-
 // PriorityQueue implements a max-heap
 type PriorityQueue []Token
 
@@ -46,10 +43,6 @@ func (pq *PriorityQueue) Pop() interface{} {
 	return x
 }
 
-func ComputeTokenPairHash(t1, t2 Token) TokenPairHash {
-	return TokenPairHash(t1.Freq * absInt(t1.Freq-t2.Freq) * absInt(t2.Time-t1.Time))
-}
-
 func absInt(x int) int {
 	if x < 0 {
 		return -x
@@ -81,7 +74,13 @@ func iterNbhd[T any](mat [][]T, i0, j0 int, ri, rj int, condition func(T) bool)
 	return true // If no neighbor met the condition, it's a peak
 }
 
-func findPeaks(spectrogram Spectrogram, topN int) []Token {
+// FindPeaks returns the topN loudest tokens that are the loudest within 100 bins of their frame,
+// sorted by time
+func FindPeaks(spectrogram Spectrogram, topN int) []Token {
+	if topN <= 0 {
+		return nil
+	}
+
 	var peaks []Token
 	pq := make(PriorityQueue, 0, topN)
 	heap.Init(&pq)
@@ -112,99 +111,106 @@ func findPeaks(spectrogram Spectrogram, topN int) []Token {
 		peaks = append(peaks, heap.Pop(&pq).(Token))
 	}
 
+	sortTokens(peaks)
 	return peaks
 }
 
-type Fingerprint struct {
-	Tokens []Token
-	Hashes map[TokenPairHash]struct{}
-}
+// FindWindowPeaks splits the spectrogram into blocks of 10 frames by 200 bins and returns the
+// tokenPerWindow loudest tokens of each block, sorted by time
+func FindWindowPeaks(spectrogram Spectrogram, tokenPerWindow int) []Token {
+	const (
+		SIZE_FREQ_WINDOWS int = 200
+		SIZE_TIME_WINDOWS int = 10
+	)
 
-func GetFingerPrint(audioBuff audio.Buffer, binSize, overlap int, hashTopN int, maxTokenTimeDiff int) Fingerprint {
-	spectrogram := GetSpectrogram(audioBuff, binSize, overlap)
-
-	fp := Fingerprint{
-		Tokens: findPeaks(spectrogram, hashTopN),
-		Hashes: make(map[TokenPairHash]struct{}),
+	if len(spectrogram) == 0 {
+		return nil
 	}
 
-	//fmt.Printf("found peaks successfully. There are %d peak tokens. %v\n", len(fp.Tokens), fp.Tokens[:100])
+	peaks := make([]Token, 0, tokenPerWindow*(len(spectrogram[0])/SIZE_FREQ_WINDOWS)*(len(spectrogram)/SIZE_TIME_WINDOWS))
+
+	//fmt.Printf("%d, %d, %d", len(spectrogram)/SIZE_TIME_WINDOWS, len(spectrogram[0])/SIZE_FREQ_WINDOWS, len(spectrogram[0]))
 
-	for i, t1 := range fp.Tokens {
-		for _, t2 := range fp.Tokens[i:] {
-			if t2.Time-t1.Time > maxTokenTimeDiff {
-				break
+	for tw := 0; tw < len(spectrogram)/SIZE_TIME_WINDOWS; tw++ {
+		t0, t1 := tw*SIZE_TIME_WINDOWS, min((tw+1)*SIZE_TIME_WINDOWS, len(spectrogram)-1)
+		for fw := 0; fw < len(spectrogram[0])/SIZE_FREQ_WINDOWS; fw++ {
+			f0, f1 := fw*SIZE_FREQ_WINDOWS, min((fw+1)*SIZE_FREQ_WINDOWS, len(spectrogram[0])-1)
+
+			pq := make(PriorityQueue, 0, tokenPerWindow)
+			heap.Init(&pq)
+
+			for i := t0; i < t1; i++ {
+				for j := f0; j < f1; j++ {
+					token := Token{i, j, spectrogram[i][j]}
+					if len(pq) < tokenPerWindow {
+						heap.Push(&pq, token)
+					} else if token.Amp > pq[0].Amp {
+						heap.Pop(&pq)
+						heap.Push(&pq, token)
+					}
+				}
 			}
 
-			fp.Hashes[ComputeTokenPairHash(t1, t2)] = struct{}{}
+			for pq.Len() > 0 {
+				peaks = append(peaks, heap.Pop(&pq).(Token))
+			}
 		}
 	}
 
-	return fp
+	sortTokens(peaks)
+	return peaks
 }
 
-func GetFingerPrint2(audioBuff audio.Buffer, binSize, overlap int, hashTopN int, maxTokenTimeDiff int, tokenPerWindow int) Fingerprint {
-	spectrogram := GetSpectrogram(audioBuff, binSize, overlap)
-
-	findPeaks2 := func() []Token {
-		const (
-			SIZE_FREQ_WINDOWS int = 200
-			SIZE_TIME_WINDOWS int = 10
-		)
-
-		peaks := make([]Token, 0, tokenPerWindow*(len(spectrogram[0])/SIZE_FREQ_WINDOWS)*(len(spectrogram)/SIZE_TIME_WINDOWS))
-
-		//fmt.Printf("%d, %d, %d", len(spectrogram)/SIZE_TIME_WINDOWS, len(spectrogram[0])/SIZE_FREQ_WINDOWS, len(spectrogram[0]))
-
-		for tw := 0; tw < len(spectrogram)/SIZE_TIME_WINDOWS; tw++ {
-			t0, t1 := tw*SIZE_TIME_WINDOWS, min((tw+1)*SIZE_TIME_WINDOWS, len(spectrogram)-1)
-			for fw := 0; fw < len(spectrogram[0])/SIZE_FREQ_WINDOWS; fw++ {
-				f0, f1 := fw*SIZE_FREQ_WINDOWS, min((fw+1)*SIZE_FREQ_WINDOWS, len(spectrogram[0])-1)
-
-				pq := make(PriorityQueue, 0, tokenPerWindow)
-				heap.Init(&pq)
+// Fingerprint holds the peak tokens of some audio, sorted by time, and the token pair hashes
+// computed from them. Each hash maps to the times of the anchor tokens that produced it. The hashes
+// of a SubFingerprinter are its sub-fingerprints instead, each mapping to the frames it describes.
+// Frames is the number of spectrogram frames of the audio, and Silent how many of them were silent.
+type Fingerprint struct {
+	Tokens []Token
+	Hashes map[TokenPairHash][]int
 
-				for i := t0; i < t1; i++ {
-					for j := f0; j < f1; j++ {
-						token := Token{i, j, spectrogram[i][j]}
-						if len(pq) < tokenPerWindow {
-							heap.Push(&pq, token)
-						} else if token.Amp > pq[0].Amp {
-							heap.Pop(&pq)
-							heap.Push(&pq, token)
-						}
-					}
-				}
+	Frames, Silent int
+}
 
-				for pq.Len() > 0 {
-					peaks = append(peaks, heap.Pop(&pq).(Token))
-				}
-			}
-		}
+// Append adds the tokens and hashes of a later part of the same audio, such as those returned by
+// a Stream
+func (f *Fingerprint) Append(other Fingerprint) {
+	f.Tokens = append(f.Tokens, other.Tokens...)
+	f.Frames += other.Frames
+	f.Silent += other.Silent
 
-		return peaks
+	if f.Hashes == nil {
+		f.Hashes = make(map[TokenPairHash][]int, len(other.Hashes))
 	}
+	for hash, times := range other.Hashes {
+		f.Hashes[hash] = append(f.Hashes[hash], times...)
+	}
+}
 
-	fp := Fingerprint{
-		Tokens: findPeaks2(),
-		Hashes: make(map[TokenPairHash]struct{}),
+func GetFingerPrint(audioBuff audio.Buffer, opts SpectrogramOptions, hashTopN int, zone TargetZone) (Fingerprint, error) {
+	spectrogram, err := GetSpectrogram(audioBuff, opts)
+	if err != nil {
+		return Fingerprint{}, err
 	}
 
-	fmt.Printf("found peaks successfully. There are %d peak tokens. %v\n", len(fp.Tokens), fp.Tokens[:10])
+	tokens := FindPeaks(spectrogram, hashTopN)
 
-	for i, t1 := range fp.Tokens {
-		for _, t2 := range fp.Tokens[i:] {
-			if absInt(t2.Time-t1.Time) > maxTokenTimeDiff {
-				break
-			}
-
-			if t1.Freq == t2.Freq {
-				continue
-			}
+	return Fingerprint{
+		Tokens: tokens,
+		Hashes: PairTokens(tokens, zone),
+	}, nil
+}
 
-			fp.Hashes[ComputeTokenPairHash(t1, t2)] = struct{}{}
-		}
+func GetFingerPrint2(audioBuff audio.Buffer, opts SpectrogramOptions, hashTopN int, zone TargetZone, tokenPerWindow int) (Fingerprint, error) {
+	spectrogram, err := GetSpectrogram(audioBuff, opts)
+	if err != nil {
+		return Fingerprint{}, err
 	}
 
-	return fp
+	tokens := FindWindowPeaks(spectrogram, tokenPerWindow)
+
+	return Fingerprint{
+		Tokens: tokens,
+		Hashes: PairTokens(tokens, zone),
+	}, nil
 }
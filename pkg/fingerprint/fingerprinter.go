@@ -0,0 +1,151 @@
+package fingerprint
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/go-audio/audio"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown fingerprint algorithm")
+	ErrIncompatible     = errors.New("incompatible fingerprints")
+)
+
+// Algorithm identifies a fingerprint algorithm. The version must be bumped whenever the algorithm
+// changes in a way that changes the hashes it produces.
+type Algorithm struct {
+	Name    string
+	Version int
+}
+
+func (a Algorithm) String() string {
+	return fmt.Sprintf("%s/v%d", a.Name, a.Version)
+}
+
+// Fingerprinter computes fingerprints of audio with a particular algorithm and config
+type Fingerprinter interface {
+	Fingerprint(audioBuff audio.Buffer) (Fingerprint, error)
+	Algorithm() Algorithm
+	Config() Config
+}
+
+// Stream fingerprints audio a chunk at a time. Write takes interleaved samples in the format the
+// stream was created with and returns the tokens and hashes whose target zones have closed. Flush
+// ends the audio and returns the rest. Appending the results together gives the same fingerprint
+// as fingerprinting the whole audio at once, provided the samples are at the 16 bit scale of
+// DefaultFullScale that silence is measured against.
+type Stream interface {
+	Write(samples []float64) (Fingerprint, error)
+	Flush() (Fingerprint, error)
+}
+
+// StreamFingerprinter is a Fingerprinter that can also fingerprint audio as it arrives, holding only
+// as much of it in memory as its spectrogram and target zone need
+type StreamFingerprinter interface {
+	Fingerprinter
+	NewStream(format audio.Format) (Stream, error)
+}
+
+// HashRescaler is a Fingerprinter whose hashes change when audio is played faster or slower.
+// RescaleHash returns the hash the original audio would have had for a hash of the audio played
+// factor times faster, and the ratio of the hash's frequencies to the original's. Hashes of
+// fingerprinters that aren't HashRescalers are taken to be the same at any speed.
+type HashRescaler interface {
+	RescaleHash(hash TokenPairHash, factor float64) (TokenPairHash, float64)
+}
+
+// SubFingerprinter is a Fingerprinter whose hashes are sub-fingerprints of SubFingerprintBits bits
+// for every frame rather than pairs of peaks. Noise flips a few bits of a sub-fingerprint rather than
+// losing it, so they are matched by the fraction of bits that differ over a block of frames. Its
+// tokens are the least reliable bits of each sub-fingerprint: Time is the frame, Freq the bit and
+// Amp how far the bit was from flipping.
+type SubFingerprinter interface {
+	Fingerprinter
+	SubFingerprintBits() int
+}
+
+// MelodyFingerprinter is a Fingerprinter whose hashes are the intervals between the notes of a
+// melody. Fingerprint picks the melody out of a recording, while FingerprintQuery tracks the pitch of
+// a sung, hummed or whistled query. Queries are rarely at the song's tempo, so their hashes line up
+// with the song's in order rather than at a single offset.
+type MelodyFingerprinter interface {
+	Fingerprinter
+	FingerprintQuery(audioBuff audio.Buffer) (Fingerprint, error)
+}
+
+// Factory creates a Fingerprinter with the given config, which has already been validated
+type Factory func(cfg Config) Fingerprinter
+
+var registry = make(map[string]Factory)
+
+// Register makes a fingerprint algorithm available by name. It panics if the name is already taken.
+func Register(name string, factory Factory) {
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("fingerprint algorithm '%s' registered twice", name))
+	}
+	registry[name] = factory
+}
+
+// New creates a Fingerprinter for the named algorithm
+func New(name string, cfg Config) (Fingerprinter, error) {
+	factory, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownAlgorithm, name)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	fingerprinter := factory(cfg)
+	if picksPeaks(fingerprinter) && !cfg.PicksPeaks() {
+		return nil, fmt.Errorf("%w: the %s algorithm needs peak and zone settings", ErrInvalidConfig, name)
+	}
+	if checker, ok := fingerprinter.(configChecker); ok {
+		if err := checker.checkConfig(); err != nil {
+			return nil, err
+		}
+	}
+	return fingerprinter, nil
+}
+
+// configChecker is a Fingerprinter with needs of its config beyond those Validate checks
+type configChecker interface {
+	checkConfig() error
+}
+
+// picksPeaks reports whether the fingerprinter hashes peaks. Sub-fingerprints and melodies aren't
+// made from peaks, so their configs can leave out the peak and zone settings.
+func picksPeaks(fingerprinter Fingerprinter) bool {
+	switch fingerprinter.(type) {
+	case SubFingerprinter, MelodyFingerprinter:
+		return false
+	}
+	return true
+}
+
+// Algorithms lists the names of the registered algorithms in sorted order
+func Algorithms() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckCompatible reports whether hashes computed by the fingerprinter can be matched against hashes
+// that were computed with the given algorithm and config
+func CheckCompatible(fingerprinter Fingerprinter, algorithm Algorithm, cfg Config) error {
+	if fingerprinter.Algorithm() != algorithm {
+		return fmt.Errorf("%w: algorithm %s, expected %s", ErrIncompatible, fingerprinter.Algorithm(), algorithm)
+	}
+
+	if fingerprinter.Config() != cfg {
+		return fmt.Errorf("%w: config %+v, expected %+v", ErrIncompatible, fingerprinter.Config(), cfg)
+	}
+
+	return nil
+}
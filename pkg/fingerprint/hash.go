@@ -0,0 +1,79 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math"
+)
+
+// TokenPairHash packs a landmark (an anchor token paired with a target token) into fixed bit fields:
+//
+//	bits 36-55: anchor frequency bin
+//	bits 16-35: target frequency bin
+//	bits  0-15: time delta from anchor to target, in frames (two's complement)
+//
+// Frequencies wider than 20 bits or time deltas outside the signed 16 bit range wrap around. Quad
+// hashes (NewQuadHash) are stored as TokenPairHashes too, but can't be decoded this way.
+type TokenPairHash int64
+
+const (
+	hashFreqBits = 20
+	hashTimeBits = 16
+
+	hashFreqMask = 1<<hashFreqBits - 1
+	hashTimeMask = 1<<hashTimeBits - 1
+
+	hashTargetFreqShift = hashTimeBits
+	hashAnchorFreqShift = hashTimeBits + hashFreqBits
+)
+
+// NewTokenPairHash computes the landmark hash of the anchor token paired with the target token
+func NewTokenPairHash(anchor, target Token) TokenPairHash {
+	deltaTime := target.Time - anchor.Time
+
+	return TokenPairHash(
+		int64(anchor.Freq&hashFreqMask)<<hashAnchorFreqShift |
+			int64(target.Freq&hashFreqMask)<<hashTargetFreqShift |
+			int64(deltaTime&hashTimeMask),
+	)
+}
+
+// Decode unpacks the hash back into the anchor frequency, target frequency and time delta it was
+// computed from.
+func (h TokenPairHash) Decode() (anchorFreq, targetFreq, deltaTime int) {
+	anchorFreq = int(h>>hashAnchorFreqShift) & hashFreqMask
+	targetFreq = int(h>>hashTargetFreqShift) & hashFreqMask
+
+	// sign extend the time delta field
+	deltaTime = int(h) & hashTimeMask
+	if deltaTime >= 1<<(hashTimeBits-1) {
+		deltaTime -= 1 << hashTimeBits
+	}
+
+	return anchorFreq, targetFreq, deltaTime
+}
+
+// rescaleTokenPairHash is the hash the original audio would have had for a landmark of the audio
+// played factor times faster, which raises its pitch and shortens its time deltas by the same
+// factor. It also returns the ratio of the landmark's anchor frequency to the original's.
+func rescaleTokenPairHash(cfg Config, hash TokenPairHash, factor float64) (TokenPairHash, float64) {
+	anchorFreq, targetFreq, deltaTime := hash.Decode()
+
+	rescale := func(bin int) int {
+		return int(math.Round(cfg.FrequencyBin(cfg.BinFrequency(float64(bin)) / factor)))
+	}
+
+	anchor := Token{Freq: rescale(anchorFreq)}
+	target := Token{Time: int(math.Round(float64(deltaTime) * factor)), Freq: rescale(targetFreq)}
+
+	freqRatio := factor
+	if originalHz := cfg.BinFrequency(float64(anchor.Freq)); originalHz > 0 {
+		freqRatio = cfg.BinFrequency(float64(anchorFreq)) / originalHz
+	}
+
+	return NewTokenPairHash(anchor, target), freqRatio
+}
+
+func (h TokenPairHash) String() string {
+	anchorFreq, targetFreq, deltaTime := h.Decode()
+	return fmt.Sprintf("(f1: %d, f2: %d, dt: %d)", anchorFreq, targetFreq, deltaTime)
+}
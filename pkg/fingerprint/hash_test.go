@@ -0,0 +1,21 @@
+package fingerprint
+
+import "testing"
+
+func TestTokenPairHashRoundTrip(t *testing.T) {
+	cases := []struct{ anchor, target Token }{
+		{Token{Time: 0, Freq: 0}, Token{Time: 0, Freq: 0}},
+		{Token{Time: 10, Freq: 120}, Token{Time: 35, Freq: 87}},
+		{Token{Time: 500, Freq: 3}, Token{Time: 420, Freq: 2047}},
+		{Token{Time: 0, Freq: hashFreqMask}, Token{Time: 1<<(hashTimeBits-1) - 1, Freq: hashFreqMask}},
+		{Token{Time: 1 << (hashTimeBits - 1), Freq: 1}, Token{Time: 0, Freq: 1}},
+	}
+
+	for _, c := range cases {
+		hash := NewTokenPairHash(c.anchor, c.target)
+		anchorFreq, targetFreq, deltaTime := hash.Decode()
+		if anchorFreq != c.anchor.Freq || targetFreq != c.target.Freq || deltaTime != c.target.Time-c.anchor.Time {
+			t.Errorf("%+v to %+v decoded as anchor freq %d, target freq %d, delta %d", c.anchor, c.target, anchorFreq, targetFreq, deltaTime)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-audio/audio"
+)
+
+// Melodies are matched by the intervals between their notes rather than the notes themselves, so a
+// tune hummed in any key matches the recording. Each hash packs melodyIntervals consecutive
+// intervals, and maps to the first frame of the first of their notes. Hashes ignore how long notes
+// are held, so the same tune hummed at any tempo has the same hashes.
+const (
+	melodyIntervals = 4
+	// melodyIntervalBits holds an interval of up to melodyMaxInterval semitones either way
+	melodyIntervalBits = 5
+	melodyMaxInterval  = 12
+
+	// melodyMinNoteMs is how long a pitch must be held to count as a note, and melodySmoothMs the
+	// span of the median filter that smooths the pitch track first
+	melodyMinNoteMs = 100
+	melodySmoothMs  = 50
+	// melodyNoteTolerance is how many semitones a frame can stray from the note it's part of
+	melodyNoteTolerance = 0.5
+)
+
+// Note is a held pitch of a melody. Start and Frames are in spectrogram frames, and Pitch is the
+// note's median pitch as a fractional MIDI note number.
+type Note struct {
+	Start, Frames int
+	Pitch         float64
+}
+
+// Notes segments a pitch track in Hz into notes, splitting wherever the pitch moves more than
+// melodyNoteTolerance semitones from the note so far or goes unvoiced. Notes shorter than
+// melodyMinNoteMs are dropped.
+func Notes(pitches []float64, cfg Config) []Note {
+	frameMs := cfg.FrameSeconds() * 1000
+	minFrames := max(1, int(math.Round(melodyMinNoteMs/frameMs)))
+	radius := int(math.Round(melodySmoothMs / frameMs / 2))
+
+	semitones := make([]float64, len(pitches))
+	for t, hz := range pitches {
+		if hz > 0 {
+			semitones[t] = HzToSemitones(hz)
+		}
+	}
+	semitones = smoothPitch(semitones, radius)
+
+	var res []Note
+	var held []float64
+	start := 0
+	end := func(t int) {
+		if len(held) >= minFrames {
+			res = append(res, Note{Start: start, Frames: len(held), Pitch: median(held)})
+		}
+		held, start = held[:0], t
+	}
+
+	for t, pitch := range semitones {
+		if pitch == 0 {
+			end(t + 1)
+			continue
+		}
+		if len(held) > 0 && math.Abs(pitch-median(held)) > melodyNoteTolerance {
+			end(t)
+		}
+		held = append(held, pitch)
+	}
+	end(len(semitones))
+
+	return res
+}
+
+// smoothPitch median filters the voiced frames of a pitch track in semitones, leaving unvoiced
+// frames at 0
+func smoothPitch(semitones []float64, radius int) []float64 {
+	res := make([]float64, len(semitones))
+	window := make([]float64, 0, 2*radius+1)
+	for t, pitch := range semitones {
+		if pitch == 0 {
+			continue
+		}
+
+		window = window[:0]
+		for i := max(0, t-radius); i <= min(len(semitones)-1, t+radius); i++ {
+			if semitones[i] != 0 {
+				window = append(window, semitones[i])
+			}
+		}
+		res[t] = median(window)
+	}
+	return res
+}
+
+// MelodyHashes hashes every run of melodyIntervals intervals between consecutive notes. Tokens are
+// the notes, with Freq the nearest MIDI note number and Amp how many frames the note is held.
+func MelodyHashes(notes []Note) Fingerprint {
+	res := Fingerprint{Hashes: make(map[TokenPairHash][]int)}
+
+	for _, note := range notes {
+		res.Tokens = append(res.Tokens, Token{Time: note.Start, Freq: int(math.Round(note.Pitch)), Amp: float64(note.Frames)})
+	}
+	sortTokens(res.Tokens)
+
+	for i := 0; i+melodyIntervals < len(notes); i++ {
+		hash := NewMelodyHash(notes[i : i+melodyIntervals+1])
+		res.Hashes[hash] = append(res.Hashes[hash], notes[i].Start)
+	}
+	return res
+}
+
+// NewMelodyHash packs the intervals between the notes, rounded to semitones and clamped to
+// melodyMaxInterval, the last interval in the lowest bits
+func NewMelodyHash(notes []Note) TokenPairHash {
+	var hash TokenPairHash
+	for i := 1; i < len(notes); i++ {
+		interval := int(math.Round(notes[i].Pitch - notes[i-1].Pitch))
+		interval = max(-melodyMaxInterval, min(melodyMaxInterval, interval))
+		hash = hash<<melodyIntervalBits | TokenPairHash(interval+melodyMaxInterval)
+	}
+	return hash
+}
+
+// MelodyIntervals unpacks the intervals in semitones of a melody hash, first to last
+func (h TokenPairHash) MelodyIntervals() []int {
+	res := make([]int, melodyIntervals)
+	for i := melodyIntervals - 1; i >= 0; i-- {
+		res[i] = int(h&(1<<melodyIntervalBits-1)) - melodyMaxInterval
+		h >>= melodyIntervalBits
+	}
+	return res
+}
+
+// melodies hashes the notes of the dominant melody of reference recordings (DominantPitch), and of
+// the pitch tracked by YIN in sung, hummed or whistled queries (TrackPitch)
+type melodies struct {
+	cfg Config
+}
+
+func (m melodies) checkConfig() error {
+	if need := pitchWindowSize(m.cfg.SampleRate); m.cfg.WindowSize() < need {
+		return fmt.Errorf("%w: melody algorithm needs frames of at least %d samples to track pitches down to %d Hz, got %d",
+			ErrInvalidConfig, need, pitchMinHz, m.cfg.WindowSize())
+	}
+	return nil
+}
+
+func (m melodies) Fingerprint(audioBuff audio.Buffer) (Fingerprint, error) {
+	buff, err := prepareAudio(audioBuff, m.cfg)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	// harmonics are compared across the whole recording, so the frames must not be rescaled
+	opts := m.cfg.SpectrogramOptions()
+	opts.Normalisation = NoNormalisation
+
+	spectrogram, err := GetSpectrogram(buff, opts)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	silent := SilentFrames(buff.Data, FullScale(audioBuff), m.cfg)
+	return m.hash(DominantPitch(spectrogram, m.cfg), silent), nil
+}
+
+func (m melodies) FingerprintQuery(audioBuff audio.Buffer) (Fingerprint, error) {
+	buff, err := prepareAudio(audioBuff, m.cfg)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	silent := SilentFrames(buff.Data, FullScale(audioBuff), m.cfg)
+	return m.hash(trackPitch(buff, m.cfg), silent), nil
+}
+
+// hash hashes the notes of the pitch track, leaving silent frames unvoiced
+func (m melodies) hash(pitches []float64, silent []bool) Fingerprint {
+	for t := range pitches {
+		if t < len(silent) && silent[t] {
+			pitches[t] = 0
+		}
+	}
+
+	res := MelodyHashes(Notes(pitches, m.cfg))
+	res.Frames, res.Silent = len(silent), countSilent(silent)
+	return res
+}
+
+func (m melodies) Algorithm() Algorithm { return Algorithm{Name: "melody", Version: 1} }
+
+func (m melodies) Config() Config { return m.cfg }
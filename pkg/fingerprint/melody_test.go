@@ -0,0 +1,84 @@
+package fingerprint
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestNotes(t *testing.T) {
+	cfg, _ := Preset("melody")
+
+	// held is frames of a pitch semitones above A4, or unvoiced frames if semitones is NaN
+	held := func(semitones float64, frames int) []float64 {
+		res := make([]float64, frames)
+		if !math.IsNaN(semitones) {
+			for i := range res {
+				res[i] = 440 * math.Pow(2, semitones/12)
+			}
+		}
+		return res
+	}
+	track := func(parts ...[]float64) []float64 {
+		var res []float64
+		for _, part := range parts {
+			res = append(res, part...)
+		}
+		return res
+	}
+
+	cases := []struct {
+		name    string
+		pitches []float64
+		notes   []Note
+	}{
+		// the median of the two pitches held equally long is halfway between them
+		{"within tolerance", track(held(0, 20), held(0.45, 20)), []Note{{Start: 0, Frames: 40, Pitch: 69.225}}},
+		{"beyond tolerance", track(held(0, 20), held(0.55, 20)), []Note{{Start: 0, Frames: 20, Pitch: 69}, {Start: 20, Frames: 20, Pitch: 69.55}}},
+		{"unvoiced gap", track(held(0, 20), held(math.NaN(), 5), held(0, 20)), []Note{{Start: 0, Frames: 20, Pitch: 69}, {Start: 25, Frames: 20, Pitch: 69}}},
+		{"short note dropped", track(held(0, 20), held(math.NaN(), 2), held(7, 2), held(math.NaN(), 2), held(3, 20)), []Note{{Start: 0, Frames: 20, Pitch: 69}, {Start: 26, Frames: 20, Pitch: 72}}},
+	}
+
+	for _, c := range cases {
+		notes := Notes(c.pitches, cfg)
+		if len(notes) != len(c.notes) {
+			t.Errorf("%s: notes %+v, expected %+v", c.name, notes, c.notes)
+			continue
+		}
+		for i, note := range notes {
+			want := c.notes[i]
+			if note.Start != want.Start || note.Frames != want.Frames || math.Abs(note.Pitch-want.Pitch) > 1e-9 {
+				t.Errorf("%s: note %d is %+v, expected %+v", c.name, i, note, want)
+			}
+		}
+	}
+}
+
+func TestMelodyHashRoundTrip(t *testing.T) {
+	// notes is a melody from middle C with the intervals in semitones between its notes
+	notes := func(intervals ...float64) []Note {
+		res := []Note{{Pitch: 60}}
+		for _, interval := range intervals {
+			res = append(res, Note{Pitch: res[len(res)-1].Pitch + interval})
+		}
+		return res
+	}
+
+	cases := []struct {
+		name      string
+		notes     []Note
+		intervals []int
+	}{
+		{"steps", notes(2, 2, 1, 2), []int{2, 2, 1, 2}},
+		{"leaps both ways", notes(12, -12, 7, -5), []int{12, -12, 7, -5}},
+		{"repeated notes", notes(0, 0, 3, 0), []int{0, 0, 3, 0}},
+		{"rounded", notes(2.4, -0.6, 4.5, -3.2), []int{2, -1, 5, -3}},
+		{"clamped", notes(15, -20, 13, -13), []int{12, -12, 12, -12}},
+	}
+
+	for _, c := range cases {
+		if got := NewMelodyHash(c.notes).MelodyIntervals(); !reflect.DeepEqual(got, c.intervals) {
+			t.Errorf("%s: intervals %v, expected %v", c.name, got, c.intervals)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Normalisation is a strategy for rescaling a spectrogram so that its peaks reflect local spectral
+// prominence rather than how loud the audio happens to be
+type Normalisation string
+
+const (
+	// NoNormalisation leaves the spectrogram untouched. The empty Normalisation is also none.
+	NoNormalisation Normalisation = "none"
+	// FrameMax scales each frame by its loudest bin
+	FrameMax Normalisation = "frame-max"
+	// FrameRMS scales each frame by its RMS level
+	FrameRMS Normalisation = "frame-rms"
+	// RunningLoudness scales each frame by an exponential moving average of the RMS level of the
+	// frames up to and including it
+	RunningLoudness Normalisation = "running-loudness"
+	// BandWhitening scales each band by its average level over the whole spectrogram, flattening the
+	// long term spectrum
+	BandWhitening Normalisation = "band-whitening"
+	// BandMedian scales each bin by the median level of its band in the surrounding frames
+	BandMedian Normalisation = "band-median"
+)
+
+// NormaliseOptions chooses the normalisation strategy. Frames is the number of frames averaged by
+// RunningLoudness and the width of the BandMedian window. Decibel spectrograms have their reference
+// level subtracted rather than divided out.
+type NormaliseOptions struct {
+	Strategy Normalisation
+	Frames   int
+	Decibels bool
+}
+
+func (n Normalisation) validate() error {
+	switch n {
+	case "", NoNormalisation, FrameMax, FrameRMS, RunningLoudness, BandWhitening, BandMedian:
+		return nil
+	default:
+		return fmt.Errorf("unknown normalisation '%s'", n)
+	}
+}
+
+// usesFrames reports whether the strategy needs a window of frames
+func (n Normalisation) usesFrames() bool {
+	return n == RunningLoudness || n == BandMedian
+}
+
+// Normalise rescales the spectrogram in place
+func Normalise(spectrogram Spectrogram, opts NormaliseOptions) error {
+	if err := opts.Strategy.validate(); err != nil {
+		return err
+	}
+
+	if opts.Strategy.usesFrames() && opts.Frames <= 0 {
+		return fmt.Errorf("%s normalisation needs a positive number of frames, got %d", opts.Strategy, opts.Frames)
+	}
+
+	rescale := opts.rescale
+
+	switch opts.Strategy {
+	case FrameMax:
+		for _, frame := range spectrogram {
+			ref := maxFloat(frame)
+			for f := range frame {
+				frame[f] = rescale(frame[f], ref)
+			}
+		}
+
+	case FrameRMS:
+		for _, frame := range spectrogram {
+			ref := frameLevel(frame, opts.Decibels)
+			for f := range frame {
+				frame[f] = rescale(frame[f], ref)
+			}
+		}
+
+	case RunningLoudness:
+		alpha, ref := 1/float64(opts.Frames), 0.0
+		for t, frame := range spectrogram {
+			if level := frameLevel(frame, opts.Decibels); t == 0 {
+				ref = level
+			} else {
+				ref += alpha * (level - ref)
+			}
+
+			for f := range frame {
+				frame[f] = rescale(frame[f], ref)
+			}
+		}
+
+	case BandWhitening:
+		if len(spectrogram) == 0 {
+			return nil
+		}
+
+		means := make([]float64, len(spectrogram[0]))
+		for _, frame := range spectrogram {
+			for f := range means {
+				means[f] += frame[f] / float64(len(spectrogram))
+			}
+		}
+
+		for _, frame := range spectrogram {
+			for f := range means {
+				frame[f] = rescale(frame[f], means[f])
+			}
+		}
+
+	case BandMedian:
+		if len(spectrogram) == 0 {
+			return nil
+		}
+
+		half := opts.Frames / 2
+		medians := make(Spectrogram, len(spectrogram))
+		window := make([]float64, 0, 2*half+1)
+		for t := range spectrogram {
+			medians[t] = make([]float64, len(spectrogram[t]))
+			for f := range spectrogram[t] {
+				window = window[:0]
+				for i := max(0, t-half); i <= min(len(spectrogram)-1, t+half); i++ {
+					window = append(window, spectrogram[i][f])
+				}
+				medians[t][f] = median(window)
+			}
+		}
+
+		for t, frame := range spectrogram {
+			for f := range frame {
+				frame[f] = rescale(frame[f], medians[t][f])
+			}
+		}
+	}
+
+	return nil
+}
+
+// rescale expresses x relative to the reference level
+func (opts NormaliseOptions) rescale(x, ref float64) float64 {
+	if opts.Decibels {
+		return x - ref
+	}
+	if ref <= 0 {
+		return x
+	}
+	return x / ref
+}
+
+// frameLevel is the RMS level of a linear frame, or the mean level of a decibel frame
+func frameLevel(frame []float64, decibels bool) float64 {
+	if len(frame) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for _, x := range frame {
+		if decibels {
+			sum += x
+		} else {
+			sum += x * x
+		}
+	}
+
+	if decibels {
+		return sum / float64(len(frame))
+	}
+	return math.Sqrt(sum / float64(len(frame)))
+}
+
+// median sorts arr and returns its middle value
+func median(arr []float64) float64 {
+	sort.Float64s(arr)
+	if len(arr)%2 == 0 {
+		return (arr[len(arr)/2-1] + arr[len(arr)/2]) / 2
+	}
+	return arr[len(arr)/2]
+}
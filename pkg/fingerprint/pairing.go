@@ -0,0 +1,56 @@
+package fingerprint
+
+import "sort"
+
+// TargetZone bounds the tokens each anchor token is paired with. Targets must come MinTimeDelta to
+// MaxTimeDelta frames after the anchor and lie within MaxFreqDelta bins of it. At most FanOut of
+// the closest such targets are paired with each anchor, so the number of hashes grows linearly with
+// the number of tokens no matter how densely they are packed.
+type TargetZone struct {
+	MinTimeDelta, MaxTimeDelta int
+	MaxFreqDelta               int
+	FanOut                     int
+}
+
+// sortTokens sorts tokens by time, then frequency
+func sortTokens(tokens []Token) {
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].Time != tokens[j].Time {
+			return tokens[i].Time < tokens[j].Time
+		}
+		return tokens[i].Freq < tokens[j].Freq
+	})
+}
+
+// PairTokens hashes each token against the targets in its zone. tokens must be sorted by time.
+func PairTokens(tokens []Token, zone TargetZone) map[TokenPairHash][]int {
+	hashes := make(map[TokenPairHash][]int)
+	pairAnchors(tokens, len(tokens), zone, hashes)
+	return hashes
+}
+
+// pairAnchors hashes the first numAnchors tokens against the targets in their zones, adding the
+// hashes to hashes
+func pairAnchors(tokens []Token, numAnchors int, zone TargetZone, hashes map[TokenPairHash][]int) {
+	for i, anchor := range tokens[:numAnchors] {
+		paired := 0
+		for _, target := range tokens[i+1:] {
+			if paired >= zone.FanOut {
+				break
+			}
+
+			deltaTime := target.Time - anchor.Time
+			if deltaTime > zone.MaxTimeDelta {
+				break
+			}
+
+			if deltaTime < zone.MinTimeDelta || absInt(target.Freq-anchor.Freq) > zone.MaxFreqDelta {
+				continue
+			}
+
+			hash := NewTokenPairHash(anchor, target)
+			hashes[hash] = append(hashes[hash], anchor.Time)
+			paired++
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package fingerprint
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+// PeakOptions configures FindLocalPeaks. A peak must be the loudest bin within TimeRadius frames and
+// FreqRadius bins of itself, and louder than the mean of that neighbourhood by ThresholdDeviations
+// standard deviations. The threshold adapts to the local level of the spectrogram, so peaks are
+// found in quiet passages as well as loud ones.
+type PeakOptions struct {
+	TimeRadius, FreqRadius int
+	ThresholdDeviations    float64
+}
+
+// FindLocalPeaks returns the 2D local maxima of the spectrogram that clear the adaptive threshold,
+// sorted by time. The neighbourhood maximum and mean are computed with sliding window filters, so
+// the cost does not grow with the size of the neighbourhood.
+func FindLocalPeaks(spectrogram Spectrogram, opts PeakOptions) []Token {
+	if len(spectrogram) == 0 || len(spectrogram[0]) == 0 {
+		return nil
+	}
+
+	numFrames, numBins := len(spectrogram), len(spectrogram[0])
+
+	// max over frequency within each frame, then over time within each bin
+	freqMax := make(Spectrogram, numFrames)
+	var deque []int
+	for t, frame := range spectrogram {
+		freqMax[t] = make([]float64, numBins)
+		deque = slidingMax(frame, freqMax[t], opts.FreqRadius, deque)
+	}
+
+	column, columnMax := make([]float64, numFrames), make([]float64, numFrames)
+	localMax := make(Spectrogram, numFrames)
+	for t := range localMax {
+		localMax[t] = make([]float64, numBins)
+	}
+	for f := 0; f < numBins; f++ {
+		for t := range column {
+			column[t] = freqMax[t][f]
+		}
+		deque = slidingMax(column, columnMax, opts.TimeRadius, deque)
+		for t := range column {
+			localMax[t][f] = columnMax[t]
+		}
+	}
+
+	sums, squares := integralImages(spectrogram)
+
+	var peaks []Token
+	for t, frame := range spectrogram {
+		t0, t1 := max(0, t-opts.TimeRadius), min(numFrames, t+opts.TimeRadius+1)
+		for f, amp := range frame {
+			if amp < localMax[t][f] {
+				continue
+			}
+
+			f0, f1 := max(0, f-opts.FreqRadius), min(numBins, f+opts.FreqRadius+1)
+			n := float64((t1 - t0) * (f1 - f0))
+			mean := boxSum(sums, t0, t1, f0, f1) / n
+			variance := max(0, boxSum(squares, t0, t1, f0, f1)/n-mean*mean)
+
+			if amp > mean+opts.ThresholdDeviations*math.Sqrt(variance) {
+				peaks = append(peaks, Token{t, f, amp})
+			}
+		}
+	}
+
+	// peaks are found in time order already
+	return peaks
+}
+
+// LoudestTokens keeps the n loudest tokens, sorted by time
+func LoudestTokens(tokens []Token, n int) []Token {
+	if len(tokens) <= n {
+		sortTokens(tokens)
+		return tokens
+	}
+
+	pq := make(PriorityQueue, 0, n)
+	for _, token := range tokens {
+		if pq.Len() < n {
+			heap.Push(&pq, token)
+		} else if n > 0 && token.Amp > pq[0].Amp {
+			heap.Pop(&pq)
+			heap.Push(&pq, token)
+		}
+	}
+
+	res := []Token(pq)
+	sortTokens(res)
+	return res
+}
+
+// slidingMax sets out[i] to the maximum of in[i-r:i+r+1] using a monotonic deque of indices, which
+// is returned for reuse
+func slidingMax(in, out []float64, r int, deque []int) []int {
+	deque = deque[:0]
+	next := 0
+	for i := range out {
+		// bring the right edge of the window up to i+r
+		for ; next < len(in) && next <= i+r; next++ {
+			for len(deque) > 0 && in[deque[len(deque)-1]] <= in[next] {
+				deque = deque[:len(deque)-1]
+			}
+			deque = append(deque, next)
+		}
+
+		// drop indices that have fallen off the left edge
+		for deque[0] < i-r {
+			deque = deque[1:]
+		}
+
+		out[i] = in[deque[0]]
+	}
+	return deque
+}
+
+// integralImages returns the summed area tables of the spectrogram and of its squares, padded with
+// a leading row and column of zeros
+func integralImages(spectrogram Spectrogram) (sums, squares [][]float64) {
+	numBins := len(spectrogram[0])
+
+	sums, squares = make([][]float64, len(spectrogram)+1), make([][]float64, len(spectrogram)+1)
+	sums[0], squares[0] = make([]float64, numBins+1), make([]float64, numBins+1)
+	for t, frame := range spectrogram {
+		sums[t+1], squares[t+1] = make([]float64, numBins+1), make([]float64, numBins+1)
+
+		rowSum, rowSquares := 0.0, 0.0
+		for f, amp := range frame {
+			rowSum += amp
+			rowSquares += amp * amp
+			sums[t+1][f+1] = sums[t][f+1] + rowSum
+			squares[t+1][f+1] = squares[t][f+1] + rowSquares
+		}
+	}
+	return sums, squares
+}
+
+// boxSum is the sum of frames [t0, t1) and bins [f0, f1) from a summed area table
+func boxSum(table [][]float64, t0, t1, f0, f1 int) float64 {
+	return table[t1][f1] - table[t0][f1] - table[t1][f0] + table[t0][f0]
+}
+
+// DensityOptions configures SelectPeaks. The spectrogram is cut into segments of SegmentFrames
+// frames and into frequency bands at BandEdges, where band i covers bins BandEdges[i] up to
+// BandEdges[i+1]. PerBand tokens are kept from each band of each segment.
+type DensityOptions struct {
+	SegmentFrames int
+	BandEdges     []int
+	PerBand       int
+}
+
+// SelectPeaks keeps the loudest tokens of each segment and band so that long and short audio, and
+// busy and sparse parts of the spectrum, all end up with a similar density of tokens. Tokens outside
+// the bands are dropped. tokens must be sorted by time and the result is too.
+func SelectPeaks(tokens []Token, opts DensityOptions) []Token {
+	numBands := len(opts.BandEdges) - 1
+	if numBands < 1 || opts.SegmentFrames < 1 {
+		return nil
+	}
+
+	var res []Token
+	bands := make([][]Token, numBands)
+	for start := 0; start < len(tokens); {
+		// gather the tokens of the segment into their bands
+		segment := tokens[start].Time / opts.SegmentFrames
+		for i := range bands {
+			bands[i] = bands[i][:0]
+		}
+
+		end := start
+		for ; end < len(tokens) && tokens[end].Time/opts.SegmentFrames == segment; end++ {
+			band := sort.SearchInts(opts.BandEdges, tokens[end].Freq+1) - 1
+			if band >= 0 && band < numBands {
+				bands[band] = append(bands[band], tokens[end])
+			}
+		}
+
+		for _, band := range bands {
+			res = append(res, LoudestTokens(band, opts.PerBand)...)
+		}
+		start = end
+	}
+
+	sortTokens(res)
+	return res
+}
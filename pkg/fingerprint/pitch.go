@@ -0,0 +1,200 @@
+package fingerprint
+
+import (
+	"math"
+
+	"github.com/go-audio/audio"
+)
+
+// Pitch is tracked with de Cheveigné and Kawahara's YIN, from "YIN, a fundamental frequency
+// estimator for speech and music", for monophonic audio such as humming, and by harmonic summation
+// over the spectrogram for the dominant melody of a recording.
+const (
+	// pitchMinHz and pitchMaxHz bound the fundamentals searched for, from a low male voice to a
+	// whistle
+	pitchMinHz = 80
+	pitchMaxHz = 1000
+
+	// yinThreshold is the largest aperiodicity a frame can have and still be voiced
+	yinThreshold = 0.15
+	// yinSilence is the level, relative to the loudest frame, below which a frame is taken to be
+	// silent rather than unvoiced
+	yinSilence = 0.01
+
+	// salienceHarmonics is the number of harmonics summed into the salience of a fundamental, each
+	// weighted salienceDecay times the one below it
+	salienceHarmonics = 8
+	salienceDecay     = 0.8
+	// salienceStepsPerSemitone is how finely candidate fundamentals are spaced
+	salienceStepsPerSemitone = 5
+	// salienceVoicing is the fraction of the recording's mean salience a frame's melody needs to be
+	// voiced, so gaps between phrases aren't filled with accompaniment
+	salienceVoicing = 0.5
+)
+
+// TrackPitch estimates the fundamental frequency in Hz of each frame of monophonic audio, framed as
+// the spectrogram computed with the config would be. Unvoiced and silent frames have a pitch of 0.
+func TrackPitch(audioBuff audio.Buffer, cfg Config) ([]float64, error) {
+	buff, err := prepareAudio(audioBuff, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return trackPitch(buff, cfg), nil
+}
+
+// trackPitch is TrackPitch of audio already prepared for the config
+func trackPitch(buff *audio.FloatBuffer, cfg Config) []float64 {
+	opts := cfg.SpectrogramOptions()
+	frames := chunkAndNormaliseAudio(buff, opts.BinSize, opts.Overlap)
+
+	minLag := max(2, int(float64(cfg.SampleRate)/pitchMaxHz))
+	maxLag := min(cfg.WindowSize()/2, int(math.Ceil(float64(cfg.SampleRate)/pitchMinHz)))
+
+	res := make([]float64, len(frames))
+	if minLag >= maxLag {
+		// the frames are too short to hold two periods of any pitch searched for
+		return res
+	}
+
+	levels := make([]float64, len(frames))
+	loudest := 0.0
+	for t, frame := range frames {
+		for _, x := range frame {
+			levels[t] += x * x
+		}
+		levels[t] = math.Sqrt(levels[t] / float64(max(1, len(frame))))
+		loudest = max(loudest, levels[t])
+	}
+
+	diff := make([]float64, maxLag+1)
+	for t, frame := range frames {
+		if len(frame) < 2*maxLag || levels[t] <= yinSilence*loudest {
+			continue
+		}
+		res[t] = yinPitch(frame, diff, minLag, maxLag, cfg.SampleRate)
+	}
+	return res
+}
+
+// pitchWindowSize is the number of samples a frame needs to hold two periods of the lowest pitch
+// searched for, which YIN compares
+func pitchWindowSize(sampleRate int) int {
+	return 2 * int(math.Ceil(float64(sampleRate)/pitchMinHz))
+}
+
+// yinPitch is the YIN estimate of the frame's fundamental, or 0 if the frame is aperiodic. diff is
+// scratch space for lags up to maxLag.
+func yinPitch(frame, diff []float64, minLag, maxLag, sampleRate int) float64 {
+	window := len(frame) - maxLag
+
+	// cumulative mean normalised difference function
+	sum := 0.0
+	diff[0] = 1
+	for lag := 1; lag <= maxLag; lag++ {
+		d := 0.0
+		for i := 0; i < window; i++ {
+			delta := frame[i] - frame[i+lag]
+			d += delta * delta
+		}
+		sum += d
+		if sum == 0 {
+			diff[lag] = 1
+		} else {
+			diff[lag] = d * float64(lag) / sum
+		}
+	}
+
+	// the first dip below the threshold, followed down to its minimum
+	lag := minLag
+	for lag < maxLag && diff[lag] >= yinThreshold {
+		lag++
+	}
+	if diff[lag] >= yinThreshold {
+		return 0
+	}
+	for lag < maxLag && diff[lag+1] < diff[lag] {
+		lag++
+	}
+
+	// parabolic interpolation of the dip between lags
+	refined := float64(lag)
+	if lag > 1 && lag < maxLag {
+		a, b, c := diff[lag-1], diff[lag], diff[lag+1]
+		if denom := a - 2*b + c; denom > 0 {
+			refined += (a - c) / (2 * denom)
+		}
+	}
+	return float64(sampleRate) / refined
+}
+
+// DominantPitch estimates the fundamental frequency in Hz of the most salient note in each frame of
+// the spectrogram computed with the config, usually the melody of a recording. A fundamental's
+// salience is the weighted sum of the magnitudes at its harmonics. Frames whose melody is much
+// weaker than the recording's average are unvoiced, with a pitch of 0.
+func DominantPitch(spectrogram Spectrogram, cfg Config) []float64 {
+	if len(spectrogram) == 0 {
+		return nil
+	}
+
+	bins := min(cfg.spectrumBins(), len(spectrogram[0]))
+	steps := int(12 * salienceStepsPerSemitone * math.Log2(pitchMaxHz/pitchMinHz))
+
+	// harmonicBins[s][h] is the fractional bin of harmonic h+1 of candidate fundamental s
+	harmonicBins := make([][]float64, steps+1)
+	for s := range harmonicBins {
+		f0 := pitchMinHz * math.Pow(2, float64(s)/(12*salienceStepsPerSemitone))
+		for h := 1; h <= salienceHarmonics; h++ {
+			if bin := cfg.FrequencyBin(f0 * float64(h)); bin >= 0 && bin <= float64(bins-1) {
+				harmonicBins[s] = append(harmonicBins[s], bin)
+			}
+		}
+	}
+
+	res := make([]float64, len(spectrogram))
+	saliences := make([]float64, len(spectrogram))
+	for t, frame := range spectrogram {
+		best := 0
+		for s, harmonics := range harmonicBins {
+			salience, weight := 0.0, 1.0
+			for _, bin := range harmonics {
+				salience += weight * interpolateBin(frame, bin, cfg.Magnitude)
+				weight *= salienceDecay
+			}
+			if salience > saliences[t] {
+				saliences[t], best = salience, s
+			}
+		}
+		res[t] = pitchMinHz * math.Pow(2, float64(best)/(12*salienceStepsPerSemitone))
+	}
+
+	mean := 0.0
+	for _, salience := range saliences {
+		mean += salience
+	}
+	mean /= float64(len(saliences))
+
+	for t, salience := range saliences {
+		if salience == 0 || salience < salienceVoicing*mean {
+			res[t] = 0
+		}
+	}
+	return res
+}
+
+// interpolateBin is the linear magnitude at a fractional bin of the frame
+func interpolateBin(frame []float64, bin float64, magnitude MagnitudeScale) float64 {
+	lo := int(bin)
+	hi := min(lo+1, len(frame)-1)
+	frac := bin - float64(lo)
+
+	a, b := frame[lo], frame[hi]
+	if magnitude == DecibelMagnitude {
+		a, b = math.Pow(10, a/20), math.Pow(10, b/20)
+	}
+	return a*(1-frac) + b*frac
+}
+
+// HzToSemitones converts a frequency to fractional MIDI note numbers, where 69 is A4 at 440 Hz
+func HzToSemitones(hz float64) float64 {
+	return 69 + 12*math.Log2(hz/440)
+}
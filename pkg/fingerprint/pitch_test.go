@@ -0,0 +1,69 @@
+package fingerprint
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+// sine is seconds of a tone at hz
+func sine(hz, seconds float64, sampleRate int) *audio.FloatBuffer {
+	data := make([]float64, int(seconds*float64(sampleRate)))
+	for i := range data {
+		data[i] = 8000 * math.Sin(2*math.Pi*hz*float64(i)/float64(sampleRate))
+	}
+	return &audio.FloatBuffer{Data: data, Format: &audio.Format{SampleRate: sampleRate, NumChannels: 1}}
+}
+
+func TestTrackPitch(t *testing.T) {
+	cfg, _ := Preset("melody")
+
+	for _, hz := range []float64{110, 220, 440, 880} {
+		pitches, err := TrackPitch(sine(hz, 1, cfg.SampleRate), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the last frames are cut short by the end of the audio, so are left unvoiced
+		voiced := 0
+		for frame, pitch := range pitches {
+			if pitch == 0 {
+				continue
+			}
+			voiced++
+			if math.Abs(HzToSemitones(pitch)-HzToSemitones(hz)) > 0.1 {
+				t.Errorf("%v Hz: frame %d tracked at %.1f Hz", hz, frame, pitch)
+				break
+			}
+		}
+		if voiced < len(pitches)*9/10 {
+			t.Errorf("%v Hz: only %d of %d frames voiced", hz, voiced, len(pitches))
+		}
+	}
+}
+
+func TestTrackPitchShortWindow(t *testing.T) {
+	cfg, _ := Preset("melody")
+	cfg.SampleRate, cfg.WindowMs, cfg.HopMs = 44100, 0.5, 0.25
+	cfg.Scale, cfg.Bands, cfg.MinHz, cfg.MaxHz = LinearScale, 0, 0, 0
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New("melody", cfg); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("melody algorithm accepted frames of %d samples, got error %v", cfg.WindowSize(), err)
+	}
+
+	// frames too short for any pitch are unvoiced rather than out of range
+	pitches, err := TrackPitch(sine(440, 0.1, cfg.SampleRate), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for frame, pitch := range pitches {
+		if pitch != 0 {
+			t.Fatalf("frame %d of %d samples tracked at %.1f Hz", frame, cfg.WindowSize(), pitch)
+		}
+	}
+}
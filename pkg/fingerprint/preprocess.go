@@ -0,0 +1,133 @@
+package fingerprint
+
+import (
+	"math"
+
+	"github.com/go-audio/audio"
+)
+
+const (
+	// resampleZeroCrossings is the number of zero crossings of the sinc kept either side of the
+	// centre of the resampling filter
+	resampleZeroCrossings = 16
+	// resampleRolloff places the filter cutoff just below the lower of the two nyquist rates
+	resampleRolloff = 0.95
+	// resampleKaiserBeta gives the filter around 80 dB of stop band attenuation
+	resampleKaiserBeta = 8
+)
+
+// Preprocess downmixes the audio to mono and resamples it to sampleRate, so audio from any source is
+// analysed the same way
+func Preprocess(audioBuff audio.Buffer, sampleRate int) (*audio.FloatBuffer, error) {
+	format := audioBuff.PCMFormat()
+	if format == nil || format.SampleRate <= 0 {
+		return nil, ErrNoSampleRate
+	}
+
+	samples := Downmix(audioBuff.AsFloatBuffer().Data, format.NumChannels)
+	if format.SampleRate != sampleRate {
+		samples = newResampler(format.SampleRate, sampleRate).resample(samples)
+	}
+
+	return &audio.FloatBuffer{
+		Data:   samples,
+		Format: &audio.Format{SampleRate: sampleRate, NumChannels: 1},
+	}, nil
+}
+
+// Downmix averages interleaved channels into a single channel
+func Downmix(samples []float64, numChannels int) []float64 {
+	if numChannels <= 1 {
+		return samples
+	}
+
+	res := make([]float64, len(samples)/numChannels)
+	for i := range res {
+		sum := 0.0
+		for _, x := range samples[i*numChannels : (i+1)*numChannels] {
+			sum += x
+		}
+		res[i] = sum / float64(numChannels)
+	}
+	return res
+}
+
+// Resample converts mono audio from one sample rate to another
+func Resample(samples []float64, fromRate, toRate int) []float64 {
+	if fromRate == toRate {
+		return samples
+	}
+	return newResampler(fromRate, toRate).resample(samples)
+}
+
+// resampler is a rational polyphase resampler. Conceptually the audio is upsampled by inserting
+// up-1 zeros between samples, low pass filtered with a Kaiser windowed sinc and decimated by keeping
+// every down'th sample, but only the filter taps that land on real input samples are evaluated.
+type resampler struct {
+	up, down int
+	filter   []float64
+	centre   int
+}
+
+func newResampler(fromRate, toRate int) *resampler {
+	divisor := gcd(fromRate, toRate)
+	up, down := toRate/divisor, fromRate/divisor
+
+	// cutoff in cycles per upsampled sample
+	cutoff := resampleRolloff * 0.5 / float64(max(up, down))
+
+	centre := resampleZeroCrossings * max(up, down)
+	filter := kaiserWindow(2*centre+1, resampleKaiserBeta)
+	for i := range filter {
+		x := 2 * cutoff * float64(i-centre)
+		sinc := 1.0
+		if x != 0 {
+			sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+
+		// the gain of up makes up for the energy lost to the inserted zeros
+		filter[i] *= float64(up) * 2 * cutoff * sinc
+	}
+
+	return &resampler{up: up, down: down, filter: filter, centre: centre}
+}
+
+func (r *resampler) resample(samples []float64) []float64 {
+	res := make([]float64, len(samples)*r.up/r.down)
+	for m := range res {
+		res[m] = r.sample(samples, 0, m)
+	}
+	return res
+}
+
+// sample computes output sample m from the input samples, the first of which is input sample
+// offset. Inputs outside of samples are taken to be zero.
+func (r *resampler) sample(samples []float64, offset, m int) float64 {
+	// position of the output sample in the upsampled signal
+	pos := m * r.down
+
+	// input sample n sits at n*up in the upsampled signal and meets filter tap pos-n*up+centre
+	first := max(offset, ceilDiv(pos+r.centre-len(r.filter)+1, r.up))
+	last := min(offset+len(samples)-1, (pos+r.centre)/r.up)
+
+	sum := 0.0
+	for n := first; n <= last; n++ {
+		sum += samples[n-offset] * r.filter[pos-n*r.up+r.centre]
+	}
+	return sum
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// ceilDiv divides rounding towards positive infinity
+func ceilDiv(a, b int) int {
+	if a <= 0 {
+		return a / b
+	}
+	return (a + b - 1) / b
+}
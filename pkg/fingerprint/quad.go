@@ -0,0 +1,116 @@
+package fingerprint
+
+import "math"
+
+// A quad hash describes four tokens: an anchor A, a far token B and the two loudest tokens C and D
+// inside the box spanned by A and B. C and D are hashed by their position within the box as a
+// fraction of its length and height, which doesn't change when the audio is sped up, slowed down
+// or shifted in pitch, so long as frequency bins are linear or logarithmic in Hz. Times are held
+// more coarsely than frequencies, as boxes are only tens of frames long.
+//
+//	bit     14: whether B is above A in frequency
+//	bits 11-13: time of C within the box
+//	bits  7-10: frequency of C within the box
+//	bits  4- 6: time of D within the box
+//	bits  0- 3: frequency of D within the box
+const (
+	quadTimeBits = 3
+	quadFreqBits = 4
+
+	quadPointBits = quadTimeBits + quadFreqBits
+	quadUpShift   = 2 * quadPointBits
+
+	// quadMinFreqSpan is the fewest bins a box can span, so that a bin's rounding can't move a
+	// token by more than a few quantisation steps
+	quadMinFreqSpan = 8
+)
+
+// NewQuadHash computes the quad hash of the tokens. c and d must lie inside the box spanned by a and
+// b, and c must come before d.
+func NewQuadHash(a, b, c, d Token) TokenPairHash {
+	point := func(token Token) int64 {
+		return quantise(token.Time-a.Time, b.Time-a.Time, quadTimeBits)<<quadFreqBits |
+			quantise(token.Freq-a.Freq, b.Freq-a.Freq, quadFreqBits)
+	}
+
+	hash := point(c)<<quadPointBits | point(d)
+	if b.Freq > a.Freq {
+		hash |= 1 << quadUpShift
+	}
+
+	return TokenPairHash(hash)
+}
+
+// quantise maps x, a fraction of span between 0 and 1, to one of 2^bits levels
+func quantise(x, span, bits int) int64 {
+	levels := 1 << bits
+	return int64(min(levels-1, max(0, int(math.Floor(float64(x)/float64(span)*float64(levels))))))
+}
+
+// QuadTokens hashes each token with the quads it anchors. tokens must be sorted by time.
+func QuadTokens(tokens []Token, zone TargetZone) map[TokenPairHash][]int {
+	hashes := make(map[TokenPairHash][]int)
+	quadAnchors(tokens, len(tokens), zone, hashes)
+	return hashes
+}
+
+// quadAnchors hashes the quads of the first numAnchors tokens, adding the hashes to hashes. B is
+// taken from the far half of the anchor's target zone so the box is wide enough to place C and D
+// in it precisely, and at most FanOut quads are hashed per anchor. The loudest tokens are chosen
+// for C and D as they are the most likely to survive noise in the query.
+func quadAnchors(tokens []Token, numAnchors int, zone TargetZone, hashes map[TokenPairHash][]int) {
+	minTimeDelta := max(zone.MinTimeDelta, zone.MaxTimeDelta/2, 2)
+
+	for i, a := range tokens[:numAnchors] {
+		quads := 0
+		for j := i + 1; j < len(tokens) && quads < zone.FanOut; j++ {
+			b := tokens[j]
+
+			deltaTime := b.Time - a.Time
+			if deltaTime > zone.MaxTimeDelta {
+				break
+			}
+
+			deltaFreq := absInt(b.Freq - a.Freq)
+			if deltaTime < minTimeDelta || deltaFreq < quadMinFreqSpan || deltaFreq > zone.MaxFreqDelta {
+				continue
+			}
+
+			// the two loudest tokens strictly inside the box, in time order
+			var c, d *Token
+			for k := i + 1; k < j; k++ {
+				token := &tokens[k]
+				if token.Time == a.Time || token.Time == b.Time || !between(token.Freq, a.Freq, b.Freq) {
+					continue
+				}
+
+				if c == nil || token.Amp > c.Amp {
+					c, d = token, c
+				} else if d == nil || token.Amp > d.Amp {
+					d = token
+				}
+			}
+			if d == nil {
+				continue
+			}
+			if d.Time < c.Time || (d.Time == c.Time && d.Freq < c.Freq) {
+				c, d = d, c
+			}
+
+			// neighbouring Bs often quantise to the same quad, which would count one chance
+			// alignment several times over
+			hash := NewQuadHash(a, b, *c, *d)
+			if times := hashes[hash]; len(times) > 0 && times[len(times)-1] == a.Time {
+				continue
+			}
+
+			hashes[hash] = append(hashes[hash], a.Time)
+			quads++
+		}
+	}
+}
+
+// between reports whether x lies strictly between a and b, in either order
+func between(x, a, b int) bool {
+	return min(a, b) < x && x < max(a, b)
+}
@@ -0,0 +1,100 @@
+package fingerprint
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// rescaleTokens is the tokens of audio played factor times faster: times shrink by the factor and
+// frequencies grow by it
+func rescaleTokens(tokens []Token, factor float64) []Token {
+	res := make([]Token, len(tokens))
+	for i, token := range tokens {
+		res[i] = Token{
+			Time: int(math.Round(float64(token.Time) / factor)),
+			Freq: int(math.Round(float64(token.Freq) * factor)),
+			Amp:  token.Amp,
+		}
+	}
+	return res
+}
+
+func TestQuadHashRescaled(t *testing.T) {
+	cases := []struct {
+		name       string
+		a, b, c, d Token
+	}{
+		{"upward box", Token{Time: 0, Freq: 200}, Token{Time: 40, Freq: 328}, Token{Time: 12, Freq: 236}, Token{Time: 28, Freq: 300}},
+		{"downward box", Token{Time: 0, Freq: 328}, Token{Time: 40, Freq: 200}, Token{Time: 12, Freq: 236}, Token{Time: 28, Freq: 300}},
+		{"c and d together", Token{Time: 0, Freq: 200}, Token{Time: 48, Freq: 264}, Token{Time: 20, Freq: 212}, Token{Time: 20, Freq: 252}},
+		{"c and d at the edges", Token{Time: 0, Freq: 400}, Token{Time: 32, Freq: 320}, Token{Time: 4, Freq: 396}, Token{Time: 28, Freq: 324}},
+	}
+
+	for _, c := range cases {
+		want := NewQuadHash(c.a, c.b, c.c, c.d)
+		for _, factor := range []float64{0.5, 2, 4} {
+			scaled := rescaleTokens([]Token{c.a, c.b, c.c, c.d}, factor)
+			if got := NewQuadHash(scaled[0], scaled[1], scaled[2], scaled[3]); got != want {
+				t.Errorf("%s: hash %x at %v times the speed, %x at the original", c.name, got, factor, want)
+			}
+		}
+	}
+
+	// whole token sets give the same quads, in a target zone scaled with them
+	tokens := []Token{
+		{Time: 0, Freq: 200, Amp: 9}, {Time: 8, Freq: 260, Amp: 5}, {Time: 12, Freq: 220, Amp: 7},
+		{Time: 20, Freq: 300, Amp: 3}, {Time: 28, Freq: 240, Amp: 6}, {Time: 36, Freq: 320, Amp: 8},
+		{Time: 44, Freq: 180, Amp: 4}, {Time: 52, Freq: 280, Amp: 2}, {Time: 60, Freq: 340, Amp: 5},
+	}
+	zone := TargetZone{MaxTimeDelta: 48, MaxFreqDelta: 400, FanOut: 10}
+	counts := func(hashes map[TokenPairHash][]int) map[TokenPairHash]int {
+		res := make(map[TokenPairHash]int, len(hashes))
+		for hash, times := range hashes {
+			res[hash] = len(times)
+		}
+		return res
+	}
+
+	want := counts(QuadTokens(tokens, zone))
+	if len(want) == 0 {
+		t.Fatal("no quads in the tokens")
+	}
+	for _, factor := range []float64{0.5, 2} {
+		scaledZone := TargetZone{
+			MaxTimeDelta: int(float64(zone.MaxTimeDelta) / factor),
+			MaxFreqDelta: int(float64(zone.MaxFreqDelta) * factor),
+			FanOut:       zone.FanOut,
+		}
+		if got := counts(QuadTokens(rescaleTokens(tokens, factor), scaledZone)); !reflect.DeepEqual(got, want) {
+			t.Errorf("quads %v at %v times the speed, %v at the original", got, factor, want)
+		}
+	}
+}
+
+func TestQuadAnchorsSkipDuplicateB(t *testing.T) {
+	// two neighbouring Bs around the same C and D give the same quad, which each anchor hashes once.
+	// The quiet first B lies inside the second's box but is never chosen as C or D.
+	quad := []Token{
+		{Time: 0, Freq: 100, Amp: 5},
+		{Time: 13, Freq: 144, Amp: 9},
+		{Time: 26, Freq: 184, Amp: 8},
+		{Time: 40, Freq: 228, Amp: 1},
+		{Time: 41, Freq: 229, Amp: 1},
+	}
+	if NewQuadHash(quad[0], quad[3], quad[1], quad[2]) != NewQuadHash(quad[0], quad[4], quad[1], quad[2]) {
+		t.Fatal("the Bs give different quads")
+	}
+
+	// a second anchor of the same quad later on is still hashed
+	tokens := append([]Token{}, quad...)
+	for _, token := range quad {
+		tokens = append(tokens, Token{Time: token.Time + 100, Freq: token.Freq, Amp: token.Amp})
+	}
+
+	hashes := QuadTokens(tokens, TargetZone{MaxTimeDelta: 48, MaxFreqDelta: 400, FanOut: 10})
+	hash := NewQuadHash(quad[0], quad[3], quad[1], quad[2])
+	if times := hashes[hash]; !reflect.DeepEqual(times, []int{0, 100}) {
+		t.Errorf("quad %v anchored at %v, expected [0 100]", hash, times)
+	}
+}
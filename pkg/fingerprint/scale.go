@@ -0,0 +1,138 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// FrequencyScale is how the FFT bins of a frame are grouped into spectrogram bins
+type FrequencyScale string
+
+const (
+	// LinearScale averages every magAveragingWindowSize FFT bins. The empty FrequencyScale is also
+	// linear.
+	LinearScale FrequencyScale = "linear"
+	// MelScale sums the FFT bins into triangular bands evenly spaced in mels, which follow the
+	// resolution of human pitch perception
+	MelScale FrequencyScale = "mel"
+	// LogScale sums the FFT bins into triangular bands evenly spaced in log frequency, so every band
+	// spans the same musical interval like a constant-Q transform
+	LogScale FrequencyScale = "log"
+)
+
+// MagnitudeScale is how spectrogram bin magnitudes are expressed
+type MagnitudeScale string
+
+const (
+	// LinearMagnitude keeps the raw magnitudes. The empty MagnitudeScale is also linear.
+	LinearMagnitude MagnitudeScale = "linear"
+	// DecibelMagnitude converts magnitudes to decibels, compressing the dynamic range so quiet
+	// bands still hold their own against loud ones
+	DecibelMagnitude MagnitudeScale = "db"
+)
+
+// decibelFloor is the magnitude treated as silence when converting to decibels
+const decibelFloor = 1e-10
+
+func (s FrequencyScale) validate() error {
+	switch s {
+	case "", LinearScale, MelScale, LogScale:
+		return nil
+	default:
+		return fmt.Errorf("unknown frequency scale '%s'", s)
+	}
+}
+
+func (m MagnitudeScale) validate() error {
+	switch m {
+	case "", LinearMagnitude, DecibelMagnitude:
+		return nil
+	default:
+		return fmt.Errorf("unknown magnitude scale '%s'", m)
+	}
+}
+
+// toDecibels converts magnitudes to decibels in place
+func toDecibels(mags []float64) {
+	for i, mag := range mags {
+		mags[i] = 20 * math.Log10(max(mag, decibelFloor))
+	}
+}
+
+func hzToMel(hz float64) float64 { return 2595 * math.Log10(1+hz/700) }
+
+func melToHz(mel float64) float64 { return 700 * (math.Pow(10, mel/2595) - 1) }
+
+// bandFilter weights the FFT bins from start onwards that make up a band
+type bandFilter struct {
+	start   int
+	weights []float64
+}
+
+// filterbank is a set of triangular bands over the positive FFT bins of a frame
+type filterbank []bandFilter
+
+// newFilterbank spaces bands evenly between minHz and maxHz on the frequency scale. Neighbouring
+// bands overlap by half, each peaking where the next starts.
+func newFilterbank(scale FrequencyScale, bands int, minHz, maxHz float64, fftSize, sampleRate int) filterbank {
+	toScale, fromScale := hzToMel, melToHz
+	if scale == LogScale {
+		toScale, fromScale = math.Log2, func(x float64) float64 { return math.Pow(2, x) }
+	}
+
+	lo, hi := toScale(minHz), toScale(maxHz)
+	edges := make([]float64, bands+2)
+	for i := range edges {
+		edges[i] = fromScale(lo + (hi-lo)*float64(i)/float64(bands+1))
+	}
+
+	binHz := float64(sampleRate) / float64(fftSize)
+	numBins := fftSize/2 + 1
+
+	bank := make(filterbank, bands)
+	for b := range bank {
+		left, centre, right := edges[b], edges[b+1], edges[b+2]
+
+		start := min(numBins-1, int(math.Ceil(left/binHz)))
+		end := min(numBins-1, int(math.Floor(right/binHz)))
+
+		weights := make([]float64, 0, max(0, end-start+1))
+		for k := start; k <= end; k++ {
+			hz := float64(k) * binHz
+			if hz <= centre {
+				weights = append(weights, (hz-left)/(centre-left))
+			} else {
+				weights = append(weights, (right-hz)/(right-centre))
+			}
+		}
+
+		// low bands can be narrower than an FFT bin, so fall back on the bin nearest the centre
+		if len(weights) == 0 || maxFloat(weights) == 0 {
+			start, weights = min(numBins-1, int(math.Round(centre/binHz))), []float64{1}
+		}
+
+		bank[b] = bandFilter{start: start, weights: weights}
+	}
+
+	return bank
+}
+
+// apply sums the magnitudes of the FFT bins in each band
+func (bank filterbank) apply(spectrum []complex128) []float64 {
+	res := make([]float64, len(bank))
+	for b, band := range bank {
+		for i, w := range band.weights {
+			res[b] += w * cmplx.Abs(spectrum[band.start+i])
+		}
+	}
+	return res
+}
+
+func maxFloat(arr []float64) float64 {
+	res := math.Inf(-1)
+	for _, x := range arr {
+		res = max(res, x)
+	}
+	return res
+}
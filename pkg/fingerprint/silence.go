@@ -0,0 +1,178 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-audio/audio"
+)
+
+// DefaultFullScale is the level of a full scale sample of audio whose scale is unknown, as the wav
+// decoder and recorder give 16 bit integers converted to floats without rescaling. Streams expect
+// samples at this scale.
+const DefaultFullScale = 1 << 15
+
+// SilenceConfig marks quiet frames as silent, so peaks aren't picked from the noise of leading and
+// trailing silence or quiet intros. The zero config marks no frames.
+type SilenceConfig struct {
+	// ThresholdDb is the RMS level of a frame, in dB relative to full scale, below which it is quiet.
+	// 0 disables silence detection, -50 is typical.
+	ThresholdDb float64 `json:"threshold_db,omitempty" yaml:"threshold_db,omitempty"`
+	// MinMs is how long audio must stay quiet before its frames count as silent, so short pauses
+	// between notes don't
+	MinMs float64 `json:"min_ms,omitempty" yaml:"min_ms,omitempty"`
+}
+
+func (s SilenceConfig) validate() error {
+	switch {
+	case s.ThresholdDb > 0:
+		return fmt.Errorf("silence threshold_db must not be positive, got %v", s.ThresholdDb)
+	case s.MinMs < 0:
+		return fmt.Errorf("silence min_ms must not be negative, got %v", s.MinMs)
+	}
+	return nil
+}
+
+// silenceDetector decides whether each frame of audio is silent as the frames arrive, in the order
+// they are cut by chunkAndNormaliseAudio. A frame is silent once the audio has been quiet for more
+// than minFrames frames, so the start of every quiet stretch is kept.
+type silenceDetector struct {
+	threshold float64
+	minFrames int
+	quiet     int
+}
+
+// newSilenceDetector detects silence in audio framed with the config whose full scale sample has
+// the level fullScale
+func newSilenceDetector(cfg Config, fullScale float64) silenceDetector {
+	if cfg.Silence.ThresholdDb == 0 {
+		return silenceDetector{threshold: -1}
+	}
+
+	return silenceDetector{
+		threshold: fullScale * math.Pow(10, cfg.Silence.ThresholdDb/20),
+		minFrames: int(math.Round(cfg.Silence.MinMs / (cfg.FrameSeconds() * 1000))),
+	}
+}
+
+// frame reports whether the next frame of audio is silent
+func (d *silenceDetector) frame(audioBin []float64) bool {
+	if d.threshold < 0 {
+		return false
+	}
+
+	level := 0.0
+	for _, x := range audioBin {
+		level += x * x
+	}
+	level = math.Sqrt(level / float64(max(1, len(audioBin))))
+
+	if level < d.threshold {
+		d.quiet++
+	} else {
+		d.quiet = 0
+	}
+	return d.quiet > d.minFrames
+}
+
+// FullScale is the level of a full scale sample of the audio. It comes from the source bit depth
+// where the buffer records one. Otherwise float audio that never exceeds 1 is taken to be
+// normalised, see GuessFullScale, and integer audio to be 16 bit.
+func FullScale(audioBuff audio.Buffer) float64 {
+	switch buff := audioBuff.(type) {
+	case *audio.IntBuffer:
+		if buff.SourceBitDepth > 0 {
+			return math.Ldexp(1, buff.SourceBitDepth-1)
+		}
+	case *audio.Float32Buffer:
+		if buff.SourceBitDepth > 0 {
+			return math.Ldexp(1, buff.SourceBitDepth-1)
+		}
+		peak := 0.0
+		for _, x := range buff.Data {
+			peak = max(peak, math.Abs(float64(x)))
+		}
+		return GuessFullScale(peak)
+	case *audio.FloatBuffer:
+		peak := 0.0
+		for _, x := range buff.Data {
+			peak = max(peak, math.Abs(x))
+		}
+		return GuessFullScale(peak)
+	}
+	return DefaultFullScale
+}
+
+// GuessFullScale is the full scale level of float audio of unknown bit depth whose loudest sample
+// has the level peak: 1 if the audio is within [-1, 1] as normalised audio is, or DefaultFullScale
+func GuessFullScale(peak float64) float64 {
+	if peak > 0 && peak <= 1 {
+		return 1
+	}
+	return DefaultFullScale
+}
+
+// SilentFrames marks the silent frames of mono audio at the config's sample rate, framed as its
+// spectrogram would be. fullScale is the level of a full scale sample, see FullScale.
+func SilentFrames(samples []float64, fullScale float64, cfg Config) []bool {
+	opts := cfg.SpectrogramOptions()
+	detector := newSilenceDetector(cfg, fullScale)
+
+	var res []bool
+	for start := 0; start < len(samples); start += opts.BinSize - opts.Overlap {
+		end := min(start+opts.BinSize, len(samples)-1)
+		res = append(res, detector.frame(samples[start:end]))
+	}
+	return res
+}
+
+// DropSilent removes the tokens that fall on silent frames
+func DropSilent(tokens []Token, silent []bool) []Token {
+	res := make([]Token, 0, len(tokens))
+	for _, token := range tokens {
+		if token.Time >= len(silent) || !silent[token.Time] {
+			res = append(res, token)
+		}
+	}
+	return res
+}
+
+// MaskSilent returns the spectrogram with its silent frames quieter than any other cell, so peaks
+// are only picked from active frames. The spectrogram itself is left as it is.
+func MaskSilent(spectrogram Spectrogram, silent []bool) Spectrogram {
+	res := make(Spectrogram, len(spectrogram))
+	var masked []float64
+	for t, frame := range spectrogram {
+		res[t] = frame
+		if t < len(silent) && silent[t] {
+			if masked == nil {
+				masked = make([]float64, len(frame))
+				for f := range masked {
+					masked[f] = math.Inf(-1)
+				}
+			}
+			res[t] = masked
+		}
+	}
+	return res
+}
+
+// ActiveFraction is the fraction of frames that aren't silent, which peak budgets set per second
+// of audio are scaled by so silence doesn't spend them
+func ActiveFraction(silent []bool) float64 {
+	if len(silent) == 0 {
+		return 1
+	}
+	return 1 - float64(countSilent(silent))/float64(len(silent))
+}
+
+// countSilent is the number of silent frames
+func countSilent(silent []bool) int {
+	n := 0
+	for _, s := range silent {
+		if s {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,93 @@
+package fingerprint
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestSilentFramesAtAnyScale(t *testing.T) {
+	cfg, _ := Preset("noisy")
+
+	// a second of silence then a second of tone, at a quarter of full scale
+	tone := func(fullScale float64) []float64 {
+		data := make([]float64, 2*cfg.SampleRate)
+		for i := cfg.SampleRate; i < len(data); i++ {
+			data[i] = fullScale / 4 * math.Sin(2*math.Pi*440*float64(i)/float64(cfg.SampleRate))
+		}
+		return data
+	}
+	format := &audio.Format{SampleRate: cfg.SampleRate, NumChannels: 1}
+
+	normalised := &audio.FloatBuffer{Data: tone(1), Format: format}
+	unscaled := &audio.FloatBuffer{Data: tone(DefaultFullScale), Format: format}
+	ints := &audio.IntBuffer{Format: format, SourceBitDepth: 24}
+	for _, x := range tone(1 << 23) {
+		ints.Data = append(ints.Data, int(x))
+	}
+
+	for name, buff := range map[string]audio.Buffer{"normalised": normalised, "16 bit": unscaled, "24 bit": ints} {
+		samples := buff.AsFloatBuffer().Data
+		silent := SilentFrames(samples, FullScale(buff), cfg)
+
+		half := len(silent) / 2
+		if countSilent(silent[:half]) == 0 {
+			t.Errorf("%s: no frames of the silence are silent", name)
+		}
+		if n := countSilent(silent[half+1:]); n > 0 {
+			t.Errorf("%s: %d frames of the tone are silent", name, n)
+		}
+	}
+}
+
+func TestSilenceSpendsNoPeaks(t *testing.T) {
+	cfg, _ := Preset("noisy")
+	const silence, chord = 6, 2
+
+	data := make([]float64, (silence+chord)*cfg.SampleRate)
+	for i := silence * cfg.SampleRate; i < len(data); i++ {
+		for _, hz := range []float64{440, 554, 659, 1760, 3520} {
+			data[i] += 3000 * math.Sin(2*math.Pi*hz*float64(i)/float64(cfg.SampleRate))
+		}
+	}
+	buff := &audio.FloatBuffer{Data: data, Format: &audio.Format{SampleRate: cfg.SampleRate, NumChannels: 1}}
+	silent := SilentFrames(data, DefaultFullScale, cfg)
+	if countSilent(silent) == 0 {
+		t.Fatal("no frames of the silence are silent")
+	}
+
+	// the global budget is for the active seconds, and the chord is louder than anything left of
+	// the silence so has every peak
+	fingerprinter, _ := New("global", cfg)
+	res, err := fingerprinter.Fingerprint(buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := float64(res.Frames-res.Silent) * cfg.FrameSeconds()
+	if budget := int(math.Ceil(cfg.PeaksPerSecond * active)); len(res.Tokens) > budget {
+		t.Errorf("global: %d peaks for %.2f active seconds, expected at most %d", len(res.Tokens), active, budget)
+	}
+	chordStart := int(silence/cfg.FrameSeconds()) - 1
+	for _, token := range res.Tokens {
+		if token.Time < chordStart {
+			t.Errorf("global: peak at frame %d, before the chord at frame %d", token.Time, chordStart)
+			break
+		}
+	}
+
+	// every block of the windowed algorithm with active frames has tokens, and no other block does
+	fingerprinter, _ = New("windowed", cfg)
+	if res, err = fingerprinter.Fingerprint(buff); err != nil {
+		t.Fatal(err)
+	}
+	blockTokens := map[int]int{}
+	for _, token := range res.Tokens {
+		blockTokens[token.Time/10]++
+	}
+	for block := 0; block < len(silent)/10; block++ {
+		if hasActive := countSilent(silent[block*10:block*10+10]) < 10; hasActive != (blockTokens[block] > 0) {
+			t.Errorf("windowed: block %d has %d tokens, active frames %v", block, blockTokens[block], hasActive)
+		}
+	}
+}
@@ -9,26 +9,162 @@ import (
 
 type Spectrogram [][]float64
 
-func GetSpectrogram(audioBuff audio.Buffer, binSize, overlap int) Spectrogram {
+// magAveragingWindowSize is the number of FFT bins averaged into each spectrogram bin
+const magAveragingWindowSize = 5
+
+// SpectrogramOptions controls how audio is split into frames of BinSize samples, overlapping by
+// Overlap samples, how each frame is windowed before its FFT and how the FFT is turned into bins
+type SpectrogramOptions struct {
+	BinSize, Overlap int
+	Window           Window
+	KaiserBeta       float64
+
+	// Scale groups the FFT into bins. The mel and log scales spread Bands bands between MinHz and
+	// MaxHz, where a MaxHz of 0 is the nyquist frequency.
+	Scale        FrequencyScale
+	Bands        int
+	MinHz, MaxHz float64
+
+	Magnitude MagnitudeScale
+
+	// NoiseSubtraction, NoiseFloor and NoiseFrames subtract the noise floor from the finished
+	// spectrogram before it is normalised, see NoiseOptions
+	NoiseSubtraction, NoiseFloor float64
+	NoiseFrames                  int
+
+	// Normalisation rescales the finished spectrogram, see Normalise
+	Normalisation   Normalisation
+	NormaliseFrames int
+}
+
+func GetSpectrogram(audioBuff audio.Buffer, opts SpectrogramOptions) (Spectrogram, error) {
+	format := audioBuff.PCMFormat()
+	if format == nil {
+		format = &audio.Format{}
+	}
+
+	analyser, err := newFrameAnalyser(opts, format.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+
 	buff := audioBuff.AsFloatBuffer()
 
 	numFrames := len(buff.Data)
-	stepSize := binSize - overlap
+	stepSize := opts.BinSize - opts.Overlap
 
-	numChunks := (numFrames - overlap + stepSize - 1) / stepSize
+	numChunks := (numFrames - opts.Overlap + stepSize - 1) / stepSize
 	if numChunks < 0 {
 		numChunks = 0
 	}
 
 	spectrogram := make(Spectrogram, 0, numChunks)
-	for _, audioBin := range chunkAndNormaliseAudio(buff, binSize, overlap) {
-		spectrogram = append(spectrogram, complex128ArrToMagArr(
-			fft.FFT(
-				float64ArrToComplex128Arr(audioBin),
-			),
-		))
-	}
-	return spectrogram
+	for _, audioBin := range chunkAndNormaliseAudio(buff, opts.BinSize, opts.Overlap) {
+		spectrogram = append(spectrogram, analyser.analyse(audioBin))
+	}
+
+	err = SubtractNoise(spectrogram, opts.noiseOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	err = Normalise(spectrogram, opts.normaliseOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	return spectrogram, nil
+}
+
+// noiseOptions are the options SubtractNoise is run with after the spectrogram is computed
+func (opts SpectrogramOptions) noiseOptions() NoiseOptions {
+	return NoiseOptions{
+		Subtraction: opts.NoiseSubtraction,
+		Floor:       opts.NoiseFloor,
+		Frames:      opts.NoiseFrames,
+		Decibels:    opts.Magnitude == DecibelMagnitude,
+	}
+}
+
+// normaliseOptions are the options Normalise is run with after the spectrogram is computed
+func (opts SpectrogramOptions) normaliseOptions() NormaliseOptions {
+	return NormaliseOptions{
+		Strategy: opts.Normalisation,
+		Frames:   opts.NormaliseFrames,
+		Decibels: opts.Magnitude == DecibelMagnitude,
+	}
+}
+
+// frameAnalyser turns frames of audio into spectrogram frames
+type frameAnalyser struct {
+	coefficients []float64
+	bank         filterbank
+	magnitude    MagnitudeScale
+	frame        []float64
+}
+
+func newFrameAnalyser(opts SpectrogramOptions, sampleRate int) (*frameAnalyser, error) {
+	coefficients, err := opts.Window.Coefficients(opts.BinSize, opts.KaiserBeta)
+	if err != nil {
+		return nil, err
+	}
+
+	var bank filterbank
+	if opts.Scale == MelScale || opts.Scale == LogScale {
+		if sampleRate <= 0 {
+			return nil, ErrNoSampleRate
+		}
+
+		maxHz := opts.MaxHz
+		if maxHz == 0 {
+			maxHz = float64(sampleRate) / 2
+		}
+		bank = newFilterbank(opts.Scale, opts.Bands, opts.MinHz, maxHz, opts.BinSize, sampleRate)
+	} else if err := opts.Scale.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := opts.Magnitude.validate(); err != nil {
+		return nil, err
+	}
+
+	return &frameAnalyser{
+		coefficients: coefficients,
+		bank:         bank,
+		magnitude:    opts.Magnitude,
+		frame:        make([]float64, opts.BinSize),
+	}, nil
+}
+
+// analyse windows the audio bin, takes its FFT and groups the result into bins
+func (a *frameAnalyser) analyse(audioBin []float64) []float64 {
+	applyWindow(a.frame, audioBin, a.coefficients)
+	spectrum := fft.FFT(float64ArrToComplex128Arr(a.frame))
+
+	var mags []float64
+	if a.bank != nil {
+		mags = a.bank.apply(spectrum)
+	} else {
+		mags = complex128ArrToMagArr(spectrum)
+	}
+
+	if a.magnitude == DecibelMagnitude {
+		toDecibels(mags)
+	}
+
+	return mags
+}
+
+// applyWindow copies the audio bin into the frame, zero padding the short bins at the end of the
+// audio, and multiplies it by the window coefficients
+func applyWindow(frame, audioBin, coefficients []float64) {
+	for i := range frame {
+		if i < len(audioBin) {
+			frame[i] = audioBin[i] * coefficients[i]
+		} else {
+			frame[i] = 0
+		}
+	}
 }
 
 func float64ArrToComplex128Arr(arr []float64) []complex128 {
@@ -40,7 +176,7 @@ func float64ArrToComplex128Arr(arr []float64) []complex128 {
 }
 
 func complex128ArrToMagArr(arr []complex128) []float64 {
-	averaging_window_size := 5
+	averaging_window_size := magAveragingWindowSize
 
 	res := make([]float64, len(arr)/averaging_window_size+1)
 	for i, c := range arr {
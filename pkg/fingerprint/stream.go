@@ -0,0 +1,384 @@
+package fingerprint
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-audio/audio"
+)
+
+var ErrStreamFlushed = errors.New("stream already flushed")
+
+func (l landmarks) NewStream(format audio.Format) (Stream, error) {
+	return newLandmarkStream(l.cfg, format, pairAnchors)
+}
+
+func (q quads) NewStream(format audio.Format) (Stream, error) {
+	return newLandmarkStream(q.cfg, format, quadAnchors)
+}
+
+// hashAnchors hashes the first numAnchors tokens with the tokens in their target zones, adding the
+// hashes to hashes
+type hashAnchors func(tokens []Token, numAnchors int, zone TargetZone, hashes map[TokenPairHash][]int)
+
+func newLandmarkStream(cfg Config, format audio.Format, hash hashAnchors) (Stream, error) {
+	if format.SampleRate <= 0 {
+		return nil, ErrNoSampleRate
+	}
+
+	if cfg.Normalisation == BandWhitening {
+		return nil, fmt.Errorf("%s normalisation needs the whole spectrogram and cannot be streamed", BandWhitening)
+	}
+
+	opts := cfg.SpectrogramOptions()
+	analyser, err := newFrameAnalyser(opts, cfg.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &landmarkStream{
+		numChannels: max(1, format.NumChannels),
+		frames:      frameStream{size: opts.BinSize, hop: opts.BinSize - opts.Overlap},
+		filter:      NewAudioFilter(cfg.Filter, cfg.SampleRate),
+		silence:     newSilenceDetector(cfg, DefaultFullScale),
+		analyser:    analyser,
+		noise:       noiseSuppressor{opts: opts.noiseOptions()},
+		normaliser:  streamNormaliser{opts: opts.normaliseOptions()},
+		peaks:       peakStream{opts: cfg.PeakOptions()},
+		density:     cfg.DensityOptions(),
+		zone:        cfg.TargetZone(),
+		hash:        hash,
+	}
+	if format.SampleRate != cfg.SampleRate {
+		stream.resampler = &streamResampler{resampler: newResampler(format.SampleRate, cfg.SampleRate)}
+	}
+
+	return stream, nil
+}
+
+// landmarkStream runs the landmark or quad algorithm over audio as it arrives. Each step only keeps
+// the audio, frames and tokens it still needs: the samples of the next frame, the frames within the
+// peak and normalisation neighbourhoods, the peaks of the current segment and the tokens within
+// the target zone of the anchors still waiting to be hashed, and whether each frame whose peaks
+// aren't yet decided is silent.
+type landmarkStream struct {
+	numChannels int
+	channels    []float64
+
+	resampler  *streamResampler
+	filter     *AudioFilter
+	frames     frameStream
+	silence    silenceDetector
+	silent     []bool
+	silentFrom int
+	analyser   *frameAnalyser
+	noise      noiseSuppressor
+	normaliser streamNormaliser
+	peaks      peakStream
+
+	density    DensityOptions
+	candidates []Token
+
+	zone    TargetZone
+	hash    hashAnchors
+	pending []Token
+
+	flushed bool
+}
+
+func (s *landmarkStream) Write(samples []float64) (Fingerprint, error) {
+	if s.flushed {
+		return Fingerprint{}, ErrStreamFlushed
+	}
+	return s.process(samples, false), nil
+}
+
+func (s *landmarkStream) Flush() (Fingerprint, error) {
+	if s.flushed {
+		return Fingerprint{}, ErrStreamFlushed
+	}
+	s.flushed = true
+
+	res := s.process(nil, true)
+	if s.frames.total() < s.frames.size {
+		return Fingerprint{}, ErrAudioTooShort
+	}
+	return res, nil
+}
+
+// process pushes the samples through each step of the algorithm. When flushing, everything still
+// buffered is treated as the end of the audio.
+func (s *landmarkStream) process(samples []float64, flush bool) Fingerprint {
+	samples = s.downmix(samples)
+	if s.resampler != nil {
+		samples = s.resampler.write(samples, flush)
+	}
+	if s.filter != nil {
+		samples = s.filter.Process(samples)
+	}
+
+	var spectrogram Spectrogram
+	silent := 0
+	s.frames.write(samples, flush, func(audioBin []float64) {
+		spectrogram = append(spectrogram, s.analyser.analyse(audioBin))
+		s.silent = append(s.silent, s.silence.frame(audioBin))
+		if s.silent[len(s.silent)-1] {
+			silent++
+		}
+	})
+	frames := len(spectrogram)
+
+	s.noise.write(spectrogram)
+	spectrogram = s.normaliser.write(spectrogram, flush)
+	for _, token := range s.peaks.write(spectrogram, flush) {
+		if !s.silent[token.Time-s.silentFrom] {
+			s.candidates = append(s.candidates, token)
+		}
+	}
+
+	// no later peak can fall before the frames already decided
+	first := min(s.silentFrom+len(s.silent), max(s.silentFrom, s.peaks.decided))
+	s.silent = append(s.silent[:0], s.silent[first-s.silentFrom:]...)
+	s.silentFrom = first
+
+	// only whole segments can have their loudest peaks selected
+	complete := len(s.candidates)
+	if !flush {
+		segmentStart := s.peaks.decided / s.density.SegmentFrames * s.density.SegmentFrames
+		for complete > 0 && s.candidates[complete-1].Time >= segmentStart {
+			complete--
+		}
+		s.pending = append(s.pending, SelectPeaks(s.candidates[:complete], s.density)...)
+		s.candidates = append(s.candidates[:0], s.candidates[complete:]...)
+	} else {
+		s.pending = append(s.pending, SelectPeaks(s.candidates, s.density)...)
+		s.candidates = nil
+	}
+
+	// anchors can be paired once every token in their target zone is known
+	numAnchors := len(s.pending)
+	if !flush {
+		selected := s.peaks.decided / s.density.SegmentFrames * s.density.SegmentFrames
+		numAnchors = 0
+		for numAnchors < len(s.pending) && s.pending[numAnchors].Time+s.zone.MaxTimeDelta < selected {
+			numAnchors++
+		}
+	}
+
+	res := Fingerprint{
+		Tokens: append([]Token(nil), s.pending[:numAnchors]...),
+		Hashes: make(map[TokenPairHash][]int),
+		Frames: frames,
+		Silent: silent,
+	}
+	s.hash(s.pending, numAnchors, s.zone, res.Hashes)
+	s.pending = append(s.pending[:0], s.pending[numAnchors:]...)
+
+	return res
+}
+
+// downmix averages the channels of each whole channel frame, keeping any partial frame for the next
+// write
+func (s *landmarkStream) downmix(samples []float64) []float64 {
+	if s.numChannels == 1 {
+		return samples
+	}
+
+	s.channels = append(s.channels, samples...)
+	whole := len(s.channels) / s.numChannels * s.numChannels
+	res := Downmix(s.channels[:whole], s.numChannels)
+	s.channels = append(s.channels[:0], s.channels[whole:]...)
+	return res
+}
+
+// streamResampler resamples audio as it arrives. Output samples are computed once every input
+// sample under their filter has arrived, and input samples are dropped once no later output needs
+// them.
+type streamResampler struct {
+	*resampler
+	samples []float64
+	offset  int
+	next    int
+}
+
+func (r *streamResampler) write(samples []float64, flush bool) []float64 {
+	r.samples = append(r.samples, samples...)
+	total := r.offset + len(r.samples)
+
+	var res []float64
+	for {
+		if flush && r.next >= total*r.up/r.down {
+			break
+		}
+		if !flush && (r.next*r.down+r.centre)/r.up >= total {
+			break
+		}
+
+		res = append(res, r.sample(r.samples, r.offset, r.next))
+		r.next++
+	}
+
+	first := min(total, max(r.offset, ceilDiv(r.next*r.down+r.centre-len(r.filter)+1, r.up)))
+	r.samples = append(r.samples[:0], r.samples[first-r.offset:]...)
+	r.offset = first
+
+	return res
+}
+
+// frameStream cuts audio into overlapping frames as it arrives, the same way as
+// chunkAndNormaliseAudio
+type frameStream struct {
+	size, hop int
+	samples   []float64
+	offset    int
+	next      int
+}
+
+// total is the number of samples written so far
+func (s *frameStream) total() int {
+	return s.offset + len(s.samples)
+}
+
+func (s *frameStream) write(samples []float64, flush bool, emit func(audioBin []float64)) {
+	s.samples = append(s.samples, samples...)
+	total := s.total()
+
+	for start := s.next * s.hop; start < total; start = s.next * s.hop {
+		end := start + s.size
+		if end >= total {
+			if !flush {
+				break
+			}
+			end = total - 1
+		}
+
+		emit(s.samples[start-s.offset : end-s.offset])
+		s.next++
+	}
+
+	first := min(total, s.next*s.hop)
+	s.samples = append(s.samples[:0], s.samples[first-s.offset:]...)
+	s.offset = first
+}
+
+// streamNormaliser normalises spectrogram frames as they arrive. BandMedian needs the frames either
+// side of each frame, so its frames are held back until the later ones arrive.
+type streamNormaliser struct {
+	opts NormaliseOptions
+
+	// running loudness
+	ref   float64
+	count int
+
+	// band median
+	frames Spectrogram
+	offset int
+	next   int
+}
+
+func (n *streamNormaliser) write(frames Spectrogram, flush bool) Spectrogram {
+	switch n.opts.Strategy {
+	case FrameMax:
+		for _, frame := range frames {
+			ref := maxFloat(frame)
+			for f := range frame {
+				frame[f] = n.opts.rescale(frame[f], ref)
+			}
+		}
+
+	case FrameRMS:
+		for _, frame := range frames {
+			ref := frameLevel(frame, n.opts.Decibels)
+			for f := range frame {
+				frame[f] = n.opts.rescale(frame[f], ref)
+			}
+		}
+
+	case RunningLoudness:
+		alpha := 1 / float64(n.opts.Frames)
+		for _, frame := range frames {
+			if level := frameLevel(frame, n.opts.Decibels); n.count == 0 {
+				n.ref = level
+			} else {
+				n.ref += alpha * (level - n.ref)
+			}
+			n.count++
+
+			for f := range frame {
+				frame[f] = n.opts.rescale(frame[f], n.ref)
+			}
+		}
+
+	case BandMedian:
+		return n.bandMedian(frames, flush)
+	}
+
+	return frames
+}
+
+func (n *streamNormaliser) bandMedian(frames Spectrogram, flush bool) Spectrogram {
+	n.frames = append(n.frames, frames...)
+	total := n.offset + len(n.frames)
+	half := n.opts.Frames / 2
+
+	var res Spectrogram
+	window := make([]float64, 0, 2*half+1)
+	for ; n.next < total && (flush || n.next+half < total); n.next++ {
+		raw := n.frames[n.next-n.offset]
+		frame := make([]float64, len(raw))
+		for f := range raw {
+			window = window[:0]
+			for i := max(0, n.next-half); i <= min(total-1, n.next+half); i++ {
+				window = append(window, n.frames[i-n.offset][f])
+			}
+			frame[f] = n.opts.rescale(raw[f], median(window))
+		}
+		res = append(res, frame)
+	}
+
+	first := min(total, max(n.offset, n.next-half))
+	n.frames = append(n.frames[:0], n.frames[first-n.offset:]...)
+	n.offset = first
+
+	return res
+}
+
+// peakStream finds the local peaks of spectrogram frames as they arrive. A frame's peaks are decided
+// once the frames within TimeRadius after it have arrived.
+type peakStream struct {
+	opts    PeakOptions
+	frames  Spectrogram
+	offset  int
+	decided int
+}
+
+func (p *peakStream) write(frames Spectrogram, flush bool) []Token {
+	p.frames = append(p.frames, frames...)
+	total := p.offset + len(p.frames)
+
+	limit := total
+	if !flush {
+		limit -= p.opts.TimeRadius
+	}
+	if limit <= p.decided {
+		return nil
+	}
+
+	// the frames before decided are only needed as the neighbourhood of the frames after it
+	start := max(p.offset, p.decided-p.opts.TimeRadius)
+
+	var res []Token
+	for _, token := range FindLocalPeaks(p.frames[start-p.offset:], p.opts) {
+		token.Time += start
+		if token.Time >= p.decided && token.Time < limit {
+			res = append(res, token)
+		}
+	}
+	p.decided = limit
+
+	first := max(p.offset, p.decided-p.opts.TimeRadius)
+	p.frames = append(p.frames[:0], p.frames[first-p.offset:]...)
+	p.offset = first
+
+	return res
+}
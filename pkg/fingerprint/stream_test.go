@@ -0,0 +1,93 @@
+package fingerprint
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+// streamAudio is stereo notes over noise at 44.1 kHz, each note with its octave, between a quiet
+// intro and outro and with a rest in the middle
+func streamAudio() *audio.FloatBuffer {
+	const sampleRate, seconds, noteSeconds = 44100, 5, 0.25
+	rng := rand.New(rand.NewSource(2))
+
+	notes := make([]float64, int(seconds/noteSeconds))
+	for i := range notes {
+		notes[i] = 220 * math.Pow(2, float64(rng.Intn(24))/12)
+	}
+
+	data := make([]float64, 2*sampleRate*seconds)
+	for i := 0; i < len(data)/2; i++ {
+		t := float64(i) / sampleRate
+		x := 3 * rng.NormFloat64()
+		if t > 1 && t < 4.5 && (t < 2.5 || t > 3) {
+			hz := notes[int(t/noteSeconds)]
+			x += 6000*math.Sin(2*math.Pi*hz*t) + 2000*math.Sin(4*math.Pi*hz*t) + 1000*rng.NormFloat64()
+		}
+		data[2*i], data[2*i+1] = x, 0.7*x
+	}
+	return &audio.FloatBuffer{Data: data, Format: &audio.Format{SampleRate: sampleRate, NumChannels: 2}}
+}
+
+func TestStreamMatchesBatch(t *testing.T) {
+	configs := map[string]Config{}
+	for _, preset := range []string{"default", "fast", "robust", "noisy"} {
+		configs[preset], _ = Preset(preset)
+	}
+	running := configs["default"]
+	running.Normalisation, running.NormaliseMs = RunningLoudness, 1000
+	configs["running-loudness"] = running
+
+	for _, algorithm := range Algorithms() {
+		for name, cfg := range configs {
+			fingerprinter, err := New(algorithm, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			streamer, ok := fingerprinter.(StreamFingerprinter)
+			if !ok {
+				continue
+			}
+
+			want, err := fingerprinter.Fingerprint(streamAudio())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(want.Hashes) == 0 {
+				t.Fatalf("%s with %s: no hashes", algorithm, name)
+			}
+
+			// odd sized chunks split channel frames as well as spectrogram frames
+			for _, chunk := range []int{3001, 44100} {
+				buff := streamAudio()
+				stream, err := streamer.NewStream(*buff.Format)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var got Fingerprint
+				for start := 0; start < len(buff.Data); start += chunk {
+					part, err := stream.Write(buff.Data[start:min(len(buff.Data), start+chunk)])
+					if err != nil {
+						t.Fatal(err)
+					}
+					got.Append(part)
+				}
+				part, err := stream.Flush()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got.Append(part)
+
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s with %s in chunks of %d: stream has %d tokens, %d hashes and %d of %d frames silent, batch has %d, %d and %d of %d",
+						algorithm, name, chunk, len(got.Tokens), len(got.Hashes), got.Silent, got.Frames, len(want.Tokens), len(want.Hashes), want.Silent, want.Frames)
+				}
+			}
+		}
+	}
+}
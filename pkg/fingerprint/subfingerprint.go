@@ -0,0 +1,99 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Sub-fingerprints follow Haitsma and Kalker's "A Highly Robust Audio Fingerprinting System". The
+// energy of each frame is summed into 33 bands spaced logarithmically between 300 and 2000 Hz, and
+// bit m of the frame's 32 bit sub-fingerprint is set when the energy difference between bands m and
+// m+1 grew since the previous frame:
+//
+//	E(n,m) - E(n,m+1) - (E(n-1,m) - E(n-1,m+1)) > 0
+//
+// The size of that change is how reliable the bit is, as small changes are the ones noise flips.
+const (
+	SubFingerprintBits = 32
+
+	subFingerprintMinHz = 300
+	subFingerprintMaxHz = 2000
+
+	// subFingerprintWeakBits is the number of least reliable bits of each sub-fingerprint kept as
+	// tokens
+	subFingerprintWeakBits = 4
+)
+
+// SubFingerprintBands is the first spectrogram bin of each sub-fingerprint band, and the bin after
+// the last band. It fails if the config's bins are too coarse to give every band a bin of its own.
+func SubFingerprintBands(cfg Config) ([]int, error) {
+	edges := make([]int, SubFingerprintBits+2)
+	for i := range edges {
+		hz := subFingerprintMinHz * math.Pow(subFingerprintMaxHz/subFingerprintMinHz, float64(i)/float64(SubFingerprintBits+1))
+		edges[i] = int(math.Ceil(cfg.FrequencyBin(hz)))
+
+		if i > 0 && edges[i] <= edges[i-1] {
+			return nil, fmt.Errorf("%w: sub-fingerprint band at %.0f Hz has no bins, the bins are %.1f Hz apart", ErrInvalidConfig, hz, cfg.FreqBinHz())
+		}
+	}
+
+	if edges[0] < 0 || edges[len(edges)-1] > cfg.spectrumBins() {
+		return nil, fmt.Errorf("%w: sub-fingerprints need bins from %d to %d Hz", ErrInvalidConfig, subFingerprintMinHz, subFingerprintMaxHz)
+	}
+
+	return edges, nil
+}
+
+// SubFingerprints computes the sub-fingerprint of every frame of a linear magnitude spectrogram
+// after the first, given the band edges from SubFingerprintBands. Each hash maps to the frames with
+// that sub-fingerprint, and the tokens are the least reliable bits of each frame. Silent frames have
+// no sub-fingerprint, as every one of their bits would be down to chance.
+func SubFingerprints(spectrogram Spectrogram, edges []int) Fingerprint {
+	res := Fingerprint{Hashes: make(map[TokenPairHash][]int)}
+
+	var prev []float64
+	changes := make([]float64, SubFingerprintBits)
+	for n, frame := range spectrogram {
+		energies, total := bandEnergies(frame, edges)
+		if prev == nil || total == 0 {
+			prev = energies
+			continue
+		}
+
+		var hash TokenPairHash
+		for m := range changes {
+			changes[m] = energies[m] - energies[m+1] - (prev[m] - prev[m+1])
+			if changes[m] > 0 {
+				hash |= 1 << m
+			}
+		}
+		res.Hashes[hash] = append(res.Hashes[hash], n)
+
+		weak := make([]Token, SubFingerprintBits)
+		for m, change := range changes {
+			weak[m] = Token{Time: n, Freq: m, Amp: math.Abs(change)}
+		}
+		sort.SliceStable(weak, func(i, j int) bool { return weak[i].Amp < weak[j].Amp })
+		weak = weak[:subFingerprintWeakBits]
+		sortTokens(weak)
+		res.Tokens = append(res.Tokens, weak...)
+
+		prev = energies
+	}
+
+	return res
+}
+
+// bandEnergies sums the energy of the frame's bins in each band, and over every band
+func bandEnergies(frame []float64, edges []int) ([]float64, float64) {
+	energies := make([]float64, len(edges)-1)
+	total := 0.0
+	for b := range energies {
+		for _, mag := range frame[edges[b]:min(edges[b+1], len(frame))] {
+			energies[b] += mag * mag
+		}
+		total += energies[b]
+	}
+	return energies, total
+}
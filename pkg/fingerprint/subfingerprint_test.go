@@ -0,0 +1,66 @@
+package fingerprint
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSubFingerprints(t *testing.T) {
+	// a band per bin, so each band's energy is its bin's magnitude squared
+	edges := make([]int, SubFingerprintBits+2)
+	for i := range edges {
+		edges[i] = i
+	}
+
+	rng := rand.New(rand.NewSource(3))
+	spectrogram := make(Spectrogram, 4)
+	for n := range spectrogram {
+		spectrogram[n] = make([]float64, len(edges)-1)
+		for b := range spectrogram[n] {
+			spectrogram[n][b] = 1 + 10*rng.Float64()
+		}
+	}
+	energy := func(n, m int) float64 { return spectrogram[n][m] * spectrogram[n][m] }
+
+	res := SubFingerprints(spectrogram, edges)
+
+	frames := make(map[int]TokenPairHash)
+	for hash, times := range res.Hashes {
+		for _, n := range times {
+			frames[n] = hash
+		}
+	}
+	if len(frames) != len(spectrogram)-1 {
+		t.Fatalf("%d sub-fingerprints of %d frames, expected all but the first", len(frames), len(spectrogram))
+	}
+
+	for n := 1; n < len(spectrogram); n++ {
+		changes := make([]Token, SubFingerprintBits)
+		for m := range changes {
+			change := energy(n, m) - energy(n, m+1) - (energy(n-1, m) - energy(n-1, m+1))
+			changes[m] = Token{Time: n, Freq: m, Amp: math.Abs(change)}
+
+			// bit m is set when the difference between bands m and m+1 grew
+			if set := frames[n]&(1<<m) != 0; set != (change > 0) {
+				t.Errorf("frame %d: bit %d set %v for a change of %.1f", n, m, set, change)
+			}
+		}
+
+		// the weak bits are the smallest changes
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Amp < changes[j].Amp })
+		weak := map[int]bool{}
+		for _, token := range changes[:subFingerprintWeakBits] {
+			weak[token.Freq] = true
+		}
+		for _, token := range res.Tokens {
+			if token.Time == n && !weak[token.Freq] {
+				t.Errorf("frame %d: bit %d is a weak token with a change of %.1f", n, token.Freq, token.Amp)
+			}
+		}
+	}
+	if len(res.Tokens) != subFingerprintWeakBits*(len(spectrogram)-1) {
+		t.Errorf("%d weak tokens, expected %d per sub-fingerprint", len(res.Tokens), subFingerprintWeakBits)
+	}
+}
@@ -0,0 +1,67 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/mjibson/go-dsp/window"
+)
+
+// Window is the analysis window applied to each spectrogram frame before its FFT. Tapering the
+// frame edges reduces the spectral leakage that smears peaks across neighbouring bins.
+type Window string
+
+const (
+	// Rectangular leaves frames untouched. The empty Window is also rectangular.
+	Rectangular Window = "rectangular"
+	Hann        Window = "hann"
+	Hamming     Window = "hamming"
+	Blackman    Window = "blackman"
+	// Kaiser is shaped by a beta parameter: 0 is rectangular and larger values trade a wider main
+	// lobe for lower side lobes
+	Kaiser Window = "kaiser"
+)
+
+// Coefficients computes the size-point window. beta is only used by the Kaiser window.
+func (w Window) Coefficients(size int, beta float64) ([]float64, error) {
+	switch w {
+	case "", Rectangular:
+		return window.Rectangular(size), nil
+	case Hann:
+		return window.Hann(size), nil
+	case Hamming:
+		return window.Hamming(size), nil
+	case Blackman:
+		return window.Blackman(size), nil
+	case Kaiser:
+		return kaiserWindow(size, beta), nil
+	default:
+		return nil, fmt.Errorf("unknown window '%s'", w)
+	}
+}
+
+func kaiserWindow(size int, beta float64) []float64 {
+	res := make([]float64, size)
+	if size == 1 {
+		res[0] = 1
+		return res
+	}
+
+	norm := besselI0(beta)
+	for n := range res {
+		x := 2*float64(n)/float64(size-1) - 1
+		res[n] = besselI0(beta*math.Sqrt(1-x*x)) / norm
+	}
+	return res
+}
+
+// besselI0 is the zeroth order modified Bessel function of the first kind, summed from its power
+// series until the terms stop contributing
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > sum*1e-12; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
@@ -0,0 +1,82 @@
+package recognizer
+
+import (
+	"math"
+
+	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+	"github.com/go-audio/audio"
+)
+
+// activityBlockSeconds is the length of the blocks of query audio that are each active or silent
+const activityBlockSeconds = 0.1
+
+// activity measures how much of a query is active rather than silent. It is measured on the query's
+// audio with the recognizer's own threshold, so mostly silent queries are refused whatever config
+// the catalog was fingerprinted with.
+type activity struct {
+	thresholdDb float64
+	// block is the number of interleaved samples per block
+	block int
+	// fullScale is the level of a full scale sample, or 0 to guess it from the loudest sample
+	fullScale float64
+
+	// levels is the RMS level of each whole block, and sum and count the partial block after them
+	levels []float64
+	sum    float64
+	count  int
+	peak   float64
+}
+
+func newActivity(opts Options, format audio.Format, fullScale float64) *activity {
+	return &activity{
+		thresholdDb: opts.SilenceDb,
+		block:       max(1, int(activityBlockSeconds*float64(format.SampleRate))*max(1, format.NumChannels)),
+		fullScale:   fullScale,
+	}
+}
+
+func (a *activity) write(samples []float64) {
+	for _, x := range samples {
+		a.sum += x * x
+		a.count++
+		a.peak = max(a.peak, math.Abs(x))
+
+		if a.count == a.block {
+			a.levels = append(a.levels, math.Sqrt(a.sum/float64(a.count)))
+			a.sum, a.count = 0, 0
+		}
+	}
+}
+
+// blocks is the number of blocks written so far, counting a partial block, and how many are active
+func (a *activity) blocks() (active, total int) {
+	levels := a.levels
+	if a.count > 0 {
+		levels = append(levels[:len(levels):len(levels)], math.Sqrt(a.sum/float64(a.count)))
+	}
+
+	fullScale := a.fullScale
+	if fullScale == 0 {
+		fullScale = fingerprint.GuessFullScale(a.peak)
+	}
+	threshold := fullScale * math.Pow(10, a.thresholdDb/20)
+
+	for _, level := range levels {
+		if a.thresholdDb == 0 || level >= threshold {
+			active++
+		}
+	}
+	return active, len(levels)
+}
+
+// seconds is the length of the active audio
+func (a *activity) seconds() float64 {
+	active, _ := a.blocks()
+	return float64(active) * activityBlockSeconds
+}
+
+// mostlySilent reports whether less than minActive of the audio is active
+func (a *activity) mostlySilent(minActive float64) bool {
+	active, total := a.blocks()
+	return total > 0 && float64(active) < minActive*float64(total)
+}
@@ -0,0 +1,53 @@
+package recognizer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-audio/audio"
+)
+
+func TestActivity(t *testing.T) {
+	format := audio.Format{SampleRate: 8000, NumChannels: 2}
+
+	// quiet seconds of silence, then loud seconds of tone, at the scale
+	recording := func(quiet, loud, scale float64) []float64 {
+		var res []float64
+		for i := 0; i < int((quiet+loud)*float64(format.SampleRate)); i++ {
+			x := 0.0
+			if float64(i) >= quiet*float64(format.SampleRate) {
+				x = scale / 2 * math.Sin(float64(i))
+			}
+			res = append(res, x, x)
+		}
+		return res
+	}
+
+	cases := []struct {
+		name         string
+		quiet, loud  float64
+		scale        float64
+		mostlySilent bool
+	}{
+		{"16 bit music", 1, 3, 1 << 15, false},
+		{"16 bit silence", 9, 1, 1 << 15, true},
+		{"normalised music", 1, 3, 1, false},
+		{"normalised silence", 9, 1, 1, true},
+	}
+
+	for _, c := range cases {
+		a := newActivity(DefaultOptions, format, 0)
+		// odd sized writes split blocks
+		samples := recording(c.quiet, c.loud, c.scale)
+		for start := 0; start < len(samples); start += 333 {
+			a.write(samples[start:min(len(samples), start+333)])
+		}
+
+		if got := a.mostlySilent(DefaultOptions.MinActive); got != c.mostlySilent {
+			t.Errorf("%s: mostly silent %v, expected %v", c.name, got, c.mostlySilent)
+		}
+		if got := a.seconds(); math.Abs(got-c.loud) > activityBlockSeconds {
+			t.Errorf("%s: %.1fs active, expected %.1fs", c.name, got, c.loud)
+		}
+	}
+}
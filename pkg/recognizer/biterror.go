@@ -0,0 +1,127 @@
+package recognizer
+
+import (
+	"context"
+	"errors"
+	"math/bits"
+	"sort"
+
+	"github.com/RobertMNewton/gozam/pkg/catalog"
+)
+
+const (
+	// bitErrorSongs is how many of the songs with the most candidate hits are compared bit by bit,
+	// and bitErrorOffsets how many of the most common offsets of each
+	bitErrorSongs   = 10
+	bitErrorOffsets = 3
+	// bitErrorSpread is how many times wider than for independent bits the bit error rates of
+	// unrelated audio spread, as neighbouring sub-fingerprints share most of their audio. Haitsma and
+	// Kalker measured about 3.
+	bitErrorSpread = 3
+)
+
+// bitErrorMatches scores the songs with the most sub-fingerprints in common with the query by their
+// bit error rate. Hits of the query's sub-fingerprints and their weak bit neighbours only nominate
+// offsets, and the whole query is compared with the song at each as one block of frames, so frames
+// whose sub-fingerprints lost more than a bit still count towards the score.
+func (m *matcher) bitErrorMatches(ctx context.Context) ([]Match, error) {
+	if len(m.frames) == 0 {
+		return nil, nil
+	}
+
+	first, last := m.queryFrames, 0
+	for frame := range m.frames {
+		first, last = min(first, frame), max(last, frame)
+	}
+
+	songIDs := make([]int64, 0, len(m.offsetCounts))
+	scores := make(map[int64]int, len(m.offsetCounts))
+	for songID := range m.offsetCounts {
+		songIDs = append(songIDs, songID)
+		scores[songID], _ = m.best(songID)
+	}
+	sort.Slice(songIDs, func(i, j int) bool {
+		if scores[songIDs[i]] != scores[songIDs[j]] {
+			return scores[songIDs[i]] > scores[songIDs[j]]
+		}
+		return songIDs[i] < songIDs[j]
+	})
+	songIDs = songIDs[:min(bitErrorSongs, len(songIDs))]
+
+	algorithm := m.recognizer.fingerprinter.Algorithm().Name
+	cfg := m.recognizer.fingerprinter.Config()
+
+	res := make([]Match, 0, len(songIDs))
+	for _, songID := range songIDs {
+		song, err := m.recognizer.catalog.Song(ctx, songID)
+		if errors.Is(err, catalog.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var best *Match
+		for _, offset := range m.topOffsets(songID, bitErrorOffsets) {
+			hashes, err := m.recognizer.catalog.SongHashes(ctx, algorithm, songID, first+offset, last+offset)
+			if err != nil {
+				return nil, err
+			}
+
+			bitErrors, compared := 0, 0
+			for _, hash := range hashes {
+				if queryHash, ok := m.frames[hash.Time-offset]; ok {
+					bitErrors += bits.OnesCount64(uint64(queryHash ^ hash.Hash))
+					compared += m.recognizer.bits
+				}
+			}
+			if compared == 0 {
+				continue
+			}
+
+			ber := float64(bitErrors) / float64(compared)
+			if best == nil || ber < best.BitErrorRate {
+				best = &Match{
+					Song:         song,
+					Score:        compared/2 - bitErrors,
+					Hashes:       m.hashCounts[songID],
+					Confidence:   m.recognizer.model.bitErrorConfidence(ber, compared, m.queryFrames),
+					Offset:       cfg.FramesToSeconds(offset),
+					Speed:        1,
+					Pitch:        1,
+					BitErrorRate: ber,
+				}
+			}
+		}
+
+		if best != nil {
+			res = append(res, *best)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Song.ID < res[j].Song.ID
+	})
+
+	return res, nil
+}
+
+// topOffsets lists up to n of the song's offsets with the most hits, most first
+func (m *matcher) topOffsets(songID int64, n int) []int {
+	offsets := make([]int, 0, len(m.offsetCounts[songID]))
+	for offset := range m.offsetCounts[songID] {
+		offsets = append(offsets, offset)
+	}
+
+	counts := m.offsetCounts[songID]
+	sort.Slice(offsets, func(i, j int) bool {
+		if counts[offsets[i]] != counts[offsets[j]] {
+			return counts[offsets[i]] > counts[offsets[j]]
+		}
+		return offsets[i] < offsets[j]
+	})
+
+	return offsets[:min(n, len(offsets))]
+}
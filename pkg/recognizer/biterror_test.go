@@ -0,0 +1,89 @@
+package recognizer
+
+import (
+	"context"
+	"math"
+	"math/bits"
+	"math/rand"
+	"testing"
+
+	"github.com/RobertMNewton/gozam/pkg/catalog"
+	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+)
+
+// songCatalog is a catalog of one song's sub-fingerprints, one per frame
+type songCatalog struct {
+	catalog.Catalog
+	song   catalog.Song
+	hashes []fingerprint.TokenPairHash
+}
+
+func (c songCatalog) Song(ctx context.Context, id int64) (catalog.Song, error) {
+	if id != c.song.ID {
+		return catalog.Song{}, catalog.ErrNotFound
+	}
+	return c.song, nil
+}
+
+func (c songCatalog) SongHashes(ctx context.Context, algorithm string, songID int64, from, to int) ([]catalog.SongHash, error) {
+	var res []catalog.SongHash
+	for frame := max(0, from); frame <= min(to, len(c.hashes)-1); frame++ {
+		res = append(res, catalog.SongHash{Hash: c.hashes[frame], Time: frame})
+	}
+	return res, nil
+}
+
+func TestBitErrorMatches(t *testing.T) {
+	const songFrames, queryFrames, offset = 40, 10, 5
+
+	rng := rand.New(rand.NewSource(4))
+	cat := songCatalog{song: catalog.Song{ID: 1, Name: "song"}}
+	for i := 0; i < songFrames; i++ {
+		cat.hashes = append(cat.hashes, fingerprint.TokenPairHash(rng.Uint32()))
+	}
+
+	cfg, _ := fingerprint.Preset("philips")
+	fingerprinter, err := fingerprint.New("philips", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &Recognizer{
+		catalog:       cat,
+		fingerprinter: fingerprinter,
+		model:         newBackgroundModel(catalog.Stats{Songs: 1, Frames: songFrames}),
+		bits:          fingerprint.SubFingerprintBits,
+	}
+
+	// the query is the song from the offset with bits flipped in a few frames, and hits nominate
+	// the right offset and a wrong one
+	m := newMatcher(rec)
+	flipped := map[int]fingerprint.TokenPairHash{0: 0b111, 4: 1 << 31, 9: 0b1010_0000}
+	bitErrors := 0
+	for frame := 0; frame < queryFrames; frame++ {
+		m.frames[frame] = cat.hashes[frame+offset] ^ flipped[frame]
+		bitErrors += bits.OnesCount64(uint64(flipped[frame]))
+	}
+	m.queryFrames = queryFrames
+	m.offsetCounts[1] = map[int]int{offset: 6, offset + 3: 2}
+	m.hashCounts[1] = 8
+
+	matches, err := m.bitErrorMatches(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("%d matches, expected 1", len(matches))
+	}
+
+	match := matches[0]
+	compared := queryFrames * fingerprint.SubFingerprintBits
+	if want := float64(bitErrors) / float64(compared); match.BitErrorRate != want {
+		t.Errorf("bit error rate %v, expected %v", match.BitErrorRate, want)
+	}
+	if want := compared/2 - bitErrors; match.Score != want {
+		t.Errorf("score %d, expected %d", match.Score, want)
+	}
+	if want := cfg.FramesToSeconds(offset); math.Abs(match.Offset-want) > 1e-9 {
+		t.Errorf("offset %.3fs, expected %.3fs", match.Offset, want)
+	}
+}
@@ -0,0 +1,120 @@
+package recognizer
+
+import (
+	"math"
+
+	"github.com/RobertMNewton/gozam/pkg/catalog"
+)
+
+// backgroundModel estimates how often query hashes line up with a song by chance. Each query hash
+// is taken to collide with rowsPerHash catalog hashes and the collisions to land evenly over every
+// offset of every song. Query hashes are as common as they are in the catalog, so rowsPerHash is
+// the average number of rows sharing each row's hash rather than the average per distinct hash,
+// which matters for algorithms whose hashes are spread unevenly.
+type backgroundModel struct {
+	rowsPerHash float64
+	songs       int64
+	frames      int64
+}
+
+func newBackgroundModel(stats catalog.Stats) backgroundModel {
+	model := backgroundModel{songs: stats.Songs, frames: stats.Frames}
+	if stats.Hashes > 0 && stats.HashPairs > 0 {
+		model.rowsPerHash = float64(stats.HashPairs) / float64(stats.Hashes)
+	} else if stats.DistinctHashes > 0 {
+		model.rowsPerHash = float64(stats.Hashes) / float64(stats.DistinctHashes)
+	}
+	return model
+}
+
+// confidence is the probability that no song offset would score as high as score if the query
+// were unrelated to the catalog
+func (b backgroundModel) confidence(score, queryHashes, queryFrames int) float64 {
+	return b.searchedConfidence(score, queryHashes, queryFrames, 1, 1)
+}
+
+// searchedConfidence is the confidence of a score found by searching several alignments of the
+// query per offset, counting the hits within width frames of the alignment
+func (b backgroundModel) searchedConfidence(score, queryHashes, queryFrames, searches, width int) float64 {
+	offsets := b.offsets(queryFrames)
+	if offsets <= 0 || score <= 0 {
+		return 0
+	}
+
+	// expected random hits at each offset
+	lambda := float64(queryHashes) * b.rowsPerHash / offsets * float64(width)
+
+	tail := poissonTail(lambda, score)
+	return math.Exp(offsets * float64(searches) * math.Log1p(-min(tail, 1)))
+}
+
+// bitErrorConfidence is the probability that no song offset would have a bit error rate as low as
+// ber over the compared bits if the query were unrelated to the catalog. Unrelated sub-fingerprints
+// differ in half their bits, and the rate is taken to be normally distributed, bitErrorSpread times
+// wider than for independent bits.
+func (b backgroundModel) bitErrorConfidence(ber float64, compared, queryFrames int) float64 {
+	offsets := b.offsets(queryFrames)
+	if offsets <= 0 || compared <= 0 {
+		return 0
+	}
+
+	deviation := bitErrorSpread * 0.5 / math.Sqrt(float64(compared))
+	tail := 0.5 * math.Erfc((0.5-ber)/deviation/math.Sqrt2)
+	return math.Exp(offsets * math.Log1p(-min(tail, 1)))
+}
+
+// chainConfidence is the probability that no song would have a chain of hits in order as long as
+// score if the query were unrelated to the catalog. A song gets a Poisson number of random hits with
+// mean lambda, and the expected number of chains of score hits among them, lambda^score/score!^2,
+// bounds the chance that any is in order.
+func (b backgroundModel) chainConfidence(score, queryHashes int) float64 {
+	if b.songs <= 0 || score <= 0 {
+		return 0
+	}
+
+	lambda := float64(queryHashes) * b.rowsPerHash / float64(b.songs)
+	if lambda <= 0 {
+		return 1
+	}
+
+	lgamma, _ := math.Lgamma(float64(score + 1))
+	tail := math.Exp(float64(score)*math.Log(lambda) - 2*lgamma)
+	return math.Exp(float64(b.songs) * math.Log1p(-min(tail, 1)))
+}
+
+// offsets is the number of ways the query can line up with the catalog's songs. A song of n frames
+// can line up with the query at n+queryFrames-1 offsets.
+func (b backgroundModel) offsets(queryFrames int) float64 {
+	return float64(b.frames + b.songs*int64(max(0, queryFrames-1)))
+}
+
+// poissonTail is the probability that a Poisson variable with mean lambda is at least k
+func poissonTail(lambda float64, k int) float64 {
+	if k <= 0 {
+		return 1
+	}
+	if lambda <= 0 {
+		return 0
+	}
+
+	// sum whichever side of the distribution has the fewest terms
+	logLambda := math.Log(lambda)
+	if float64(k) <= lambda {
+		lower := 0.0
+		for i := 0; i < k; i++ {
+			lgamma, _ := math.Lgamma(float64(i + 1))
+			lower += math.Exp(float64(i)*logLambda - lambda - lgamma)
+		}
+		return max(0, 1-lower)
+	}
+
+	lgamma, _ := math.Lgamma(float64(k + 1))
+	term := math.Exp(float64(k)*logLambda - lambda - lgamma)
+
+	sum := 0.0
+	for i := k; term > sum*1e-16; i++ {
+		sum += term
+		term *= lambda / float64(i+1)
+	}
+	return sum
+}
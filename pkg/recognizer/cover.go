@@ -0,0 +1,247 @@
+package recognizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/RobertMNewton/gozam/pkg/catalog"
+	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+	"github.com/go-audio/audio"
+)
+
+// Cover search finds live versions and covers of songs, which share none of the exact peaks that
+// landmark hashes match. The query's beat chroma is cross-correlated with each song's at every beat
+// lag and all 12 transpositions, as a cover is often played in another key, and at half and double
+// its tempo, as the beat tracker can lock onto either. Following Ellis and Poliner's "Identifying
+// Cover Songs with Chroma Features and Dynamic Programming Beat Tracking", a song is scored by how
+// far its best correlation stands out from the rest of its correlations.
+
+// CoverOptions tune how cover search scores songs
+type CoverOptions struct {
+	// Threshold is the score a cover needs to be reported, in standard deviations of the song's
+	// correlations at other lags and transpositions
+	Threshold float64
+	// MinOverlap is the fraction of the query's beats that must overlap the song at a lag for it to
+	// be correlated
+	MinOverlap float64
+}
+
+var DefaultCoverOptions = CoverOptions{
+	Threshold:  5,
+	MinOverlap: 0.5,
+}
+
+// coverTempos are the factors the query's beats are rescaled by before correlating
+var coverTempos = []float64{0.5, 1, 2}
+
+// CoverMatch is a candidate song a query may be a cover of
+type CoverMatch struct {
+	Song catalog.Song
+	// Score is how many standard deviations the song's best correlation is above its mean
+	Score float64
+	// Similarity is the mean cosine similarity of the query's beats and the song's at the best lag
+	Similarity float64
+	// Transposition is how many semitones the query is above the song, from -5 to 6
+	Transposition int
+	// Tempo is how many of the song's beats the query's beats were rescaled to, see coverTempos
+	Tempo float64
+	// Offset is where the query starts in the song, in seconds
+	Offset float64
+}
+
+// CoverSearch matches audio against the beat chroma of a catalog's songs
+type CoverSearch struct {
+	catalog catalog.Catalog
+	cfg     fingerprint.Config
+	songs   []catalog.SongChroma
+	opts    CoverOptions
+}
+
+// NewCoverSearch loads the beat chroma of every song in the catalog. They must all have been
+// computed with the same config, which queries are computed with too.
+func NewCoverSearch(ctx context.Context, cat catalog.Catalog, opts CoverOptions) (*CoverSearch, error) {
+	songs, err := cat.Chromas(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(songs) == 0 {
+		return nil, fmt.Errorf("%w: no songs have chroma for cover search", catalog.ErrNotFound)
+	}
+
+	cfg := songs[0].Config
+	for _, song := range songs[1:] {
+		if song.Config != cfg {
+			return nil, fmt.Errorf("%w: song %d chroma config %+v, expected %+v", fingerprint.ErrIncompatible, song.SongID, song.Config, cfg)
+		}
+	}
+
+	for i := range songs {
+		songs[i].Chroma = unitChroma(songs[i].Chroma)
+	}
+
+	return &CoverSearch{catalog: cat, cfg: cfg, songs: songs, opts: opts}, nil
+}
+
+func (c *CoverSearch) Config() fingerprint.Config {
+	return c.cfg
+}
+
+// Search lists every song the audio correlates with by descending score
+func (c *CoverSearch) Search(ctx context.Context, audioBuff audio.Buffer) ([]CoverMatch, error) {
+	query, err := fingerprint.GetBeatChroma(audioBuff, c.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]CoverMatch, 0, len(c.songs))
+	for _, song := range c.songs {
+		var best *CoverMatch
+		for _, tempo := range coverTempos {
+			match, ok := c.correlate(rescaleBeats(query.Chroma, tempo), song)
+			if ok && (best == nil || match.Score > best.Score) {
+				match.Tempo = tempo
+				best = &match
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		best.Song, err = c.catalog.Song(ctx, song.SongID)
+		if errors.Is(err, catalog.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		res = append(res, *best)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Song.ID < res[j].Song.ID
+	})
+
+	return res, nil
+}
+
+// Best returns the first of the matches if it scores above the threshold, or ErrNoMatch
+func (c *CoverSearch) Best(matches []CoverMatch) (CoverMatch, error) {
+	if len(matches) == 0 || matches[0].Score < c.opts.Threshold {
+		return CoverMatch{}, ErrNoMatch
+	}
+	return matches[0], nil
+}
+
+// correlate finds the lag and transposition the query's beats are most similar to the song's at.
+// It reports false if the song is too short to overlap the query at any lag.
+func (c *CoverSearch) correlate(query fingerprint.Chromagram, song catalog.SongChroma) (CoverMatch, bool) {
+	query = unitChroma(query)
+	minOverlap := max(1, int(math.Ceil(c.opts.MinOverlap*float64(len(query)))))
+
+	var best CoverMatch
+	sum, squares, n := 0.0, 0.0, 0
+	for semitones := 0; semitones < fingerprint.PitchClasses; semitones++ {
+		// rotating the query down by its transposition lines its pitch classes up with the song's
+		rotated := make(fingerprint.Chromagram, len(query))
+		for i, v := range query {
+			rotated[i] = v.Rotate(-semitones)
+		}
+
+		for lag := minOverlap - len(query); lag <= len(song.Chroma)-minOverlap; lag++ {
+			from, to := max(0, -lag), min(len(query), len(song.Chroma)-lag)
+			if to-from < minOverlap {
+				continue
+			}
+
+			sim := 0.0
+			for i := from; i < to; i++ {
+				sim += dot(rotated[i], song.Chroma[i+lag])
+			}
+			sim /= float64(to - from)
+
+			sum, squares, n = sum+sim, squares+sim*sim, n+1
+			if n == 1 || sim > best.Similarity {
+				best.Similarity, best.Transposition = sim, semitones
+				best.Offset = c.beatSeconds(song.Beats, lag)
+			}
+		}
+	}
+
+	if n < 2 {
+		return CoverMatch{}, false
+	}
+
+	mean := sum / float64(n)
+	if std := math.Sqrt(max(0, squares/float64(n)-mean*mean)); std > 0 {
+		best.Score = (best.Similarity - mean) / std
+	}
+	if best.Transposition > fingerprint.PitchClasses/2 {
+		best.Transposition -= fingerprint.PitchClasses
+	}
+	return best, true
+}
+
+// beatSeconds is the time of the song's beat in seconds, extrapolated from its first or last beats
+// if the beat is before or after them
+func (c *CoverSearch) beatSeconds(beats []int, beat int) float64 {
+	if len(beats) < 2 {
+		return 0
+	}
+
+	switch {
+	case beat < 0:
+		return c.cfg.FramesToSeconds(beats[0] + beat*(beats[1]-beats[0]))
+	case beat >= len(beats):
+		last := len(beats) - 1
+		return c.cfg.FramesToSeconds(beats[last] + (beat-last)*(beats[last]-beats[last-1]))
+	default:
+		return c.cfg.FramesToSeconds(beats[beat])
+	}
+}
+
+// rescaleBeats resamples the chroma to tempo times as many beats, averaging beats together to halve
+// the tempo and repeating them to double it
+func rescaleBeats(chroma fingerprint.Chromagram, tempo float64) fingerprint.Chromagram {
+	n := int(math.Round(float64(len(chroma)) * tempo))
+	res := make(fingerprint.Chromagram, n)
+	for i := range res {
+		from := int(float64(i) / tempo)
+		to := max(from+1, int(float64(i+1)/tempo))
+		for _, v := range chroma[from:min(to, len(chroma))] {
+			for pc, x := range v {
+				res[i][pc] += x
+			}
+		}
+	}
+	return res
+}
+
+// unitChroma scales each of the chroma vectors to unit length, so their dot product is their cosine
+// similarity. Silent beats stay zero.
+func unitChroma(chroma fingerprint.Chromagram) fingerprint.Chromagram {
+	res := make(fingerprint.Chromagram, len(chroma))
+	for i, v := range chroma {
+		norm := math.Sqrt(dot(v, v))
+		if norm == 0 {
+			continue
+		}
+		for pc, x := range v {
+			res[i][pc] = x / norm
+		}
+	}
+	return res
+}
+
+func dot(a, b fingerprint.ChromaVector) float64 {
+	res := 0.0
+	for pc := range a {
+		res += a[pc] * b[pc]
+	}
+	return res
+}
@@ -0,0 +1,89 @@
+package recognizer
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/RobertMNewton/gozam/pkg/catalog"
+)
+
+// melodyMatches scores songs by the longest chain of hits that fall in the same order in the query
+// as in the song. A hummed query keeps the order of the song's notes but not their timing, so its
+// hits don't share an offset the way a recording's do.
+func (m *matcher) melodyMatches(ctx context.Context) ([]Match, error) {
+	cfg := m.recognizer.fingerprinter.Config()
+
+	res := make([]Match, 0, len(m.pairs))
+	for songID, pairs := range m.pairs {
+		song, err := m.recognizer.catalog.Song(ctx, songID)
+		if errors.Is(err, catalog.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		chain := orderedChain(pairs)
+		first, last := chain[0], chain[len(chain)-1]
+
+		// the tempo is how much faster the song moves through the chain than the query
+		speed := 1.0
+		if last.query > first.query && last.song > first.song {
+			speed = float64(last.song-first.song) / float64(last.query-first.query)
+		}
+
+		res = append(res, Match{
+			Song:       song,
+			Score:      len(chain),
+			Hashes:     m.hashCounts[songID],
+			Confidence: m.recognizer.model.chainConfidence(len(chain), m.queryHashes),
+			Offset:     cfg.FramesToSeconds(first.song) - speed*cfg.FramesToSeconds(first.query),
+			Speed:      speed,
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Song.ID < res[j].Song.ID
+	})
+
+	return res, nil
+}
+
+// orderedChain is the longest run of the pairs that strictly increases in both query and song time,
+// found as the longest increasing subsequence of song times with the pairs sorted by query time
+func orderedChain(pairs []timePair) []timePair {
+	sorted := append([]timePair(nil), pairs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].query != sorted[j].query {
+			return sorted[i].query < sorted[j].query
+		}
+		// pairs sharing a query time can't both be in the chain, which descending song times ensure
+		return sorted[i].song > sorted[j].song
+	})
+
+	// tails[k] is the index of the pair ending the chain of length k+1 with the lowest song time
+	tails := make([]int, 0, len(sorted))
+	prev := make([]int, len(sorted))
+	for i, pair := range sorted {
+		k := sort.Search(len(tails), func(k int) bool { return sorted[tails[k]].song >= pair.song })
+
+		prev[i] = -1
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	chain := make([]timePair, len(tails))
+	for i, k := tails[len(tails)-1], len(tails)-1; k >= 0; i, k = prev[i], k-1 {
+		chain[k] = sorted[i]
+	}
+	return chain
+}
@@ -0,0 +1,53 @@
+package recognizer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrderedChain(t *testing.T) {
+	cases := []struct {
+		name  string
+		pairs []timePair
+		// length is the length of the longest chain, and chain the chain if only one is that long
+		length int
+		chain  []timePair
+	}{
+		{"in order", []timePair{{query: 0, song: 10}, {query: 1, song: 12}, {query: 2, song: 15}}, 3, []timePair{{query: 0, song: 10}, {query: 1, song: 12}, {query: 2, song: 15}}},
+		{"shuffled", []timePair{{query: 2, song: 15}, {query: 0, song: 10}, {query: 1, song: 12}}, 3, []timePair{{query: 0, song: 10}, {query: 1, song: 12}, {query: 2, song: 15}}},
+		{"stray hit", []timePair{{query: 0, song: 10}, {query: 1, song: 50}, {query: 2, song: 12}, {query: 3, song: 15}}, 3, []timePair{{query: 0, song: 10}, {query: 2, song: 12}, {query: 3, song: 15}}},
+		{"equal query times", []timePair{{query: 0, song: 10}, {query: 1, song: 11}, {query: 1, song: 12}, {query: 1, song: 13}, {query: 2, song: 14}}, 3, nil},
+		{"equal query times only", []timePair{{query: 5, song: 10}, {query: 5, song: 11}, {query: 5, song: 12}}, 1, nil},
+		{"equal song times", []timePair{{query: 0, song: 10}, {query: 1, song: 12}, {query: 2, song: 12}, {query: 3, song: 14}}, 3, nil},
+		{"one pair", []timePair{{query: 4, song: 9}}, 1, []timePair{{query: 4, song: 9}}},
+	}
+
+	for _, c := range cases {
+		chain := orderedChain(c.pairs)
+		if len(chain) != c.length {
+			t.Errorf("%s: chain %v, expected %d pairs long", c.name, chain, c.length)
+			continue
+		}
+		if c.chain != nil && !reflect.DeepEqual(chain, c.chain) {
+			t.Errorf("%s: chain %v, expected %v", c.name, chain, c.chain)
+		}
+
+		for i, pair := range chain {
+			if !containsPair(c.pairs, pair) {
+				t.Errorf("%s: chain %v has %v, which isn't one of the pairs", c.name, chain, pair)
+			}
+			if i > 0 && (pair.query <= chain[i-1].query || pair.song <= chain[i-1].song) {
+				t.Errorf("%s: chain %v doesn't strictly increase", c.name, chain)
+			}
+		}
+	}
+}
+
+func containsPair(pairs []timePair, pair timePair) bool {
+	for _, p := range pairs {
+		if p == pair {
+			return true
+		}
+	}
+	return false
+}
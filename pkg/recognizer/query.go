@@ -0,0 +1,148 @@
+package recognizer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+	"github.com/go-audio/audio"
+)
+
+// Query matches audio as it arrives, so an answer can be given as soon as one song clearly leads.
+// Streaming fingerprinters are fed each chunk as it arrives. Other fingerprinters refingerprint the
+// whole query every RefingerprintSeconds of audio. Samples are float audio within [-1, 1] or
+// integers converted to floats without rescaling, as the wav decoder and recorder give, which are
+// taken to be 16 bit.
+type Query struct {
+	recognizer *Recognizer
+	matcher    *matcher
+	format     audio.Format
+	activity   *activity
+
+	stream fingerprint.Stream
+
+	samples       []float64
+	fingerprinted int
+
+	// number of samples written
+	written int
+}
+
+// NewQuery starts a query of audio in the given format
+func (r *Recognizer) NewQuery(format audio.Format) (*Query, error) {
+	query := &Query{recognizer: r, matcher: newMatcher(r), format: format, activity: newActivity(r.opts, format, 0)}
+
+	if streamer, ok := r.fingerprinter.(fingerprint.StreamFingerprinter); ok {
+		stream, err := streamer.NewStream(format)
+		if err != nil {
+			return nil, err
+		}
+		query.stream = stream
+	}
+
+	return query, nil
+}
+
+// Write adds interleaved samples to the query and reports whether the top song is now confident.
+// A mostly silent query is never confident.
+func (q *Query) Write(ctx context.Context, samples []float64) (bool, error) {
+	q.written += len(samples)
+	q.activity.write(samples)
+
+	if q.stream != nil {
+		part, err := q.stream.Write(samples)
+		if err != nil {
+			return false, err
+		}
+
+		if err := q.matcher.add(ctx, part); err != nil {
+			return false, err
+		}
+		return q.confident(ctx)
+	}
+
+	q.samples = append(q.samples, samples...)
+
+	step := int(q.recognizer.opts.RefingerprintSeconds * float64(q.format.SampleRate*max(1, q.format.NumChannels)))
+	if len(q.samples)-q.fingerprinted < step {
+		return q.confident(ctx)
+	}
+
+	if err := q.refingerprint(ctx, false); err != nil {
+		return false, err
+	}
+	return q.confident(ctx)
+}
+
+func (q *Query) confident(ctx context.Context) (bool, error) {
+	if q.activity.mostlySilent(q.recognizer.opts.MinActive) {
+		return false, nil
+	}
+	return q.matcher.confident(ctx)
+}
+
+// Flush ends the query, matching whatever audio hasn't been matched yet
+func (q *Query) Flush(ctx context.Context) error {
+	if q.stream != nil {
+		part, err := q.stream.Flush()
+		if err != nil {
+			return err
+		}
+		return q.matcher.add(ctx, part)
+	}
+
+	if q.fingerprinted == len(q.samples) && q.fingerprinted > 0 {
+		return nil
+	}
+	return q.refingerprint(ctx, true)
+}
+
+// Duration is the length of the audio written to the query so far in seconds. A match's playback
+// position at the end of the query is its Offset plus Duration.
+func (q *Query) Duration() float64 {
+	if q.format.SampleRate <= 0 {
+		return 0
+	}
+	return float64(q.written) / float64(q.format.SampleRate*max(1, q.format.NumChannels))
+}
+
+// ActiveDuration is the length of the audio written to the query so far that wasn't silent, in
+// seconds
+func (q *Query) ActiveDuration() float64 {
+	return q.activity.seconds()
+}
+
+// Candidates lists every song sharing hashes with the query so far by descending score, or returns
+// ErrMostlySilent if too little of it is active to match
+func (q *Query) Candidates(ctx context.Context) ([]Match, error) {
+	if q.activity.mostlySilent(q.recognizer.opts.MinActive) {
+		return nil, ErrMostlySilent
+	}
+	return q.matcher.matches(ctx)
+}
+
+// Best returns the best match for the query so far, or ErrNoMatch if no song is matched confidently
+func (q *Query) Best(ctx context.Context) (Match, error) {
+	matches, err := q.Candidates(ctx)
+	if err != nil {
+		return Match{}, err
+	}
+	return q.recognizer.Best(matches)
+}
+
+// refingerprint matches the fingerprint of the whole query in place of the previous one. Too little
+// audio is not an error until the query is flushed.
+func (q *Query) refingerprint(ctx context.Context, flush bool) error {
+	q.fingerprinted = len(q.samples)
+
+	format := q.format
+	queryFingerprint, err := q.recognizer.fingerprintQuery(&audio.FloatBuffer{Data: q.samples, Format: &format})
+	if errors.Is(err, fingerprint.ErrAudioTooShort) && !flush {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	q.matcher.reset()
+	return q.matcher.add(ctx, queryFingerprint)
+}
@@ -0,0 +1,451 @@
+// module for recognising audio by matching its fingerprint against a catalog
+package recognizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/RobertMNewton/gozam/pkg/catalog"
+	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+	"github.com/go-audio/audio"
+)
+
+var (
+	ErrNoMatch        = errors.New("no confident match")
+	ErrMostlySilent   = errors.New("query is mostly silence")
+	ErrInvalidOptions = errors.New("invalid recognizer options")
+)
+
+// Options tune how confident the recognizer must be before it reports a match
+type Options struct {
+	// Threshold is the confidence a match needs to be reported
+	Threshold float64
+	// Margin is how many times the runner up's score the top song needs before a Query stops early
+	Margin float64
+	// HashTolerance also matches catalog hashes whose time delta is within this many frames of the
+	// query's. Zero only matches identical hashes. Only algorithms whose hashes are pairs of peaks,
+	// the fingerprint.HashRescalers, have a time delta to match nearby, so New refuses it for others.
+	HashTolerance int64
+	// RefingerprintSeconds is how much audio a Query collects between fingerprints when the
+	// algorithm can't stream
+	RefingerprintSeconds float64
+	// MaxSpeedDeviation also searches for the query played up to this fraction faster or slower than
+	// the song, as radio stations and DJs often do. Zero only matches the song at its own speed, as
+	// do sub-fingerprint algorithms. Melody algorithms match queries at any tempo regardless.
+	MaxSpeedDeviation float64
+	// MinActive is the fraction of a query's audio that must be active for it to be matched, and
+	// SilenceDb the level in dB relative to full scale below which audio is silent. Queries with less
+	// are refused with ErrMostlySilent. This is independent of the config's silence detection, which
+	// only decides which frames peaks are picked from. A SilenceDb of 0 counts all audio as active.
+	MinActive float64
+	SilenceDb float64
+}
+
+var DefaultOptions = Options{
+	Threshold:            0.99,
+	Margin:               2,
+	RefingerprintSeconds: 1,
+	MinActive:            0.25,
+	SilenceDb:            -50,
+}
+
+// Match is a candidate song for a query
+type Match struct {
+	Song catalog.Song
+	// Score is the number of query hashes that line up with the song at its best offset. For
+	// sub-fingerprint algorithms it is how many more of the query's bits agree with the song's than
+	// chance would give, and for melody algorithms the number of query hashes found in the song in
+	// the same order.
+	Score int
+	// Hashes is the number of query hashes found in the song at any offset
+	Hashes int
+	// Confidence is the probability that the song's score is not down to chance
+	Confidence float64
+	// Offset is where the query starts in the song, in seconds. It is the anchor time of the
+	// song's hashes less the anchor time of the query's at the best offset, converted from frames
+	// with the hop size and sample rate. It is negative if the query starts before the song does.
+	Offset float64
+	// Speed is how many seconds of the song pass per second of the query, and Pitch is the ratio of
+	// the query's frequencies to the song's. Both are 1 unless MaxSpeedDeviation is set, or Speed is
+	// the tempo a melody was hummed at. Pitch is 0 if the algorithm's hashes are the same at any
+	// pitch, as it can't be estimated from them.
+	Speed float64
+	Pitch float64
+	// BitErrorRate is the fraction of the query's sub-fingerprint bits that differ from the song's at
+	// Offset. It is only set by sub-fingerprint algorithms.
+	BitErrorRate float64
+}
+
+// Recognizer matches audio against the songs of a catalog
+type Recognizer struct {
+	catalog       catalog.Catalog
+	fingerprinter fingerprint.Fingerprinter
+	opts          Options
+	model         backgroundModel
+
+	// bits is the size of the fingerprinter's sub-fingerprints, or 0 if it hashes peaks
+	bits int
+	// melody is the fingerprinter if it hashes melodies, which queries are fingerprinted with
+	// FingerprintQuery
+	melody fingerprint.MelodyFingerprinter
+}
+
+// New creates a Recognizer that fingerprints queries with the named algorithm and config, which
+// must be compatible with the hashes in the catalog
+func New(ctx context.Context, cat catalog.Catalog, algorithm string, cfg fingerprint.Config, opts Options) (*Recognizer, error) {
+	fingerprinter, err := fingerprint.New(algorithm, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fingerprinter.(fingerprint.HashRescaler); opts.HashTolerance > 0 && !ok {
+		return nil, fmt.Errorf("%w: the %s algorithm's hashes have no time delta to tolerate", ErrInvalidOptions, algorithm)
+	}
+
+	info, err := cat.Info(ctx, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fingerprint.CheckCompatible(fingerprinter, info.Algorithm, info.Config); err != nil {
+		return nil, err
+	}
+
+	stats, err := cat.Stats(ctx, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &Recognizer{
+		catalog:       cat,
+		fingerprinter: fingerprinter,
+		opts:          opts,
+		model:         newBackgroundModel(stats),
+	}
+	if subFingerprinter, ok := fingerprinter.(fingerprint.SubFingerprinter); ok {
+		rec.bits = subFingerprinter.SubFingerprintBits()
+	}
+	rec.melody, _ = fingerprinter.(fingerprint.MelodyFingerprinter)
+
+	return rec, nil
+}
+
+func (r *Recognizer) Fingerprinter() fingerprint.Fingerprinter {
+	return r.fingerprinter
+}
+
+// Recognize returns the best match for the audio, or ErrNoMatch if no song is matched confidently.
+// It returns ErrMostlySilent if too little of the audio is active to match.
+func (r *Recognizer) Recognize(ctx context.Context, audioBuff audio.Buffer) (Match, error) {
+	queryFingerprint, err := r.fingerprintQuery(audioBuff)
+	if err != nil {
+		return Match{}, err
+	}
+
+	active := newActivity(r.opts, *audioBuff.PCMFormat(), fingerprint.FullScale(audioBuff))
+	active.write(audioBuff.AsFloatBuffer().Data)
+	if active.mostlySilent(r.opts.MinActive) {
+		return Match{}, ErrMostlySilent
+	}
+
+	matches, err := r.Candidates(ctx, queryFingerprint)
+	if err != nil {
+		return Match{}, err
+	}
+
+	return r.Best(matches)
+}
+
+// fingerprintQuery fingerprints query audio, which melody fingerprinters treat differently from
+// the reference recordings
+func (r *Recognizer) fingerprintQuery(audioBuff audio.Buffer) (fingerprint.Fingerprint, error) {
+	if r.melody != nil {
+		return r.melody.FingerprintQuery(audioBuff)
+	}
+	return r.fingerprinter.Fingerprint(audioBuff)
+}
+
+// Candidates lists every song sharing hashes with the fingerprint by descending score
+func (r *Recognizer) Candidates(ctx context.Context, queryFingerprint fingerprint.Fingerprint) ([]Match, error) {
+	m := newMatcher(r)
+	if err := m.add(ctx, queryFingerprint); err != nil {
+		return nil, err
+	}
+	return m.matches(ctx)
+}
+
+// Best returns the first of the matches if it is confident enough, or ErrNoMatch
+func (r *Recognizer) Best(matches []Match) (Match, error) {
+	if len(matches) == 0 || matches[0].Confidence < r.opts.Threshold {
+		return Match{}, ErrNoMatch
+	}
+	return matches[0], nil
+}
+
+// matcher scores the songs sharing hashes with a query fingerprint as it grows. Each song is scored
+// by the tallest bin of its histogram of db_time - query_time offsets, as hashes from the same
+// recording line up on a single offset while random collisions spread out across many.
+type matcher struct {
+	recognizer   *Recognizer
+	fingerprint  fingerprint.Fingerprint
+	hits         map[fingerprint.TokenPairHash][]catalog.Hit
+	offsetCounts map[int64]map[int]int
+	hashCounts   map[int64]int
+
+	// number of hash occurrences and frames in the query so far
+	queryHashes int
+	queryFrames int
+
+	// sub-fingerprint of each query frame, when matching sub-fingerprints
+	frames map[int]fingerprint.TokenPairHash
+	// query and song times of every hit per song, when matching melodies
+	pairs map[int64][]timePair
+
+	// candidates are the matches of the fingerprint added so far if cached is set, as they only
+	// change when more is added
+	candidates []Match
+	cached     bool
+}
+
+func newMatcher(r *Recognizer) *matcher {
+	m := &matcher{recognizer: r, hits: make(map[fingerprint.TokenPairHash][]catalog.Hit)}
+	m.reset()
+	return m
+}
+
+// reset forgets the fingerprint added so far. Hashes already looked up stay cached.
+func (m *matcher) reset() {
+	m.fingerprint = fingerprint.Fingerprint{}
+	m.offsetCounts = make(map[int64]map[int]int)
+	m.hashCounts = make(map[int64]int)
+	m.queryHashes, m.queryFrames = 0, 0
+	m.frames = make(map[int]fingerprint.TokenPairHash)
+	m.pairs = make(map[int64][]timePair)
+	m.candidates, m.cached = nil, false
+}
+
+// add bins the offsets of every hit of the fingerprint's hashes
+func (m *matcher) add(ctx context.Context, queryFingerprint fingerprint.Fingerprint) error {
+	m.fingerprint.Append(queryFingerprint)
+	m.cached = false
+
+	for hash, queryTimes := range queryFingerprint.Hashes {
+		hits, err := m.lookup(ctx, hash)
+		if err != nil {
+			return err
+		}
+
+		m.queryHashes += len(queryTimes)
+		for _, queryTime := range queryTimes {
+			m.queryFrames = max(m.queryFrames, queryTime+1)
+			if m.recognizer.bits > 0 {
+				m.frames[queryTime] = hash
+			}
+		}
+
+		m.bin(hits, queryTimes)
+	}
+
+	// noise flips the weakest bits of a sub-fingerprint first, so the sub-fingerprints with one of
+	// them flipped find candidates too
+	if m.recognizer.bits > 0 {
+		for _, weak := range queryFingerprint.Tokens {
+			hits, err := m.lookup(ctx, m.frames[weak.Time]^1<<weak.Freq)
+			if err != nil {
+				return err
+			}
+			m.bin(hits, []int{weak.Time})
+		}
+	}
+
+	return nil
+}
+
+// bin adds the time offset of every hit per song
+func (m *matcher) bin(hits []catalog.Hit, queryTimes []int) {
+	for _, hit := range hits {
+		offsets, ok := m.offsetCounts[hit.SongID]
+		if !ok {
+			offsets = make(map[int]int)
+			m.offsetCounts[hit.SongID] = offsets
+		}
+
+		for _, queryTime := range queryTimes {
+			offsets[hit.Time-queryTime]++
+			if m.recognizer.melody != nil {
+				m.pairs[hit.SongID] = append(m.pairs[hit.SongID], timePair{query: queryTime, song: hit.Time})
+			}
+		}
+		m.hashCounts[hit.SongID] += len(queryTimes)
+	}
+}
+
+func (m *matcher) lookup(ctx context.Context, hash fingerprint.TokenPairHash) ([]catalog.Hit, error) {
+	if hits, ok := m.hits[hash]; ok {
+		return hits, nil
+	}
+
+	algorithm := m.recognizer.fingerprinter.Algorithm().Name
+
+	var hits []catalog.Hit
+	var err error
+	if tolerance := m.recognizer.opts.HashTolerance; tolerance > 0 {
+		hits, err = m.recognizer.catalog.LookupNear(ctx, algorithm, hash, tolerance)
+	} else {
+		hits, err = m.recognizer.catalog.Lookup(ctx, algorithm, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.hits[hash] = hits
+	return hits, nil
+}
+
+// best is the tallest offset bin of a song, and its offset
+func (m *matcher) best(songID int64) (score, offset int) {
+	for o, count := range m.offsetCounts[songID] {
+		if count > score || (count == score && o < offset) {
+			score, offset = count, o
+		}
+	}
+	return score, offset
+}
+
+// matches lists the candidate songs by descending score
+func (m *matcher) matches(ctx context.Context) ([]Match, error) {
+	candidates, err := m.cachedMatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append([]Match(nil), candidates...), nil
+}
+
+// cachedMatches is matches without the copy, scoring the songs only if the fingerprint has changed
+// since they were last scored
+func (m *matcher) cachedMatches(ctx context.Context) ([]Match, error) {
+	if !m.cached {
+		candidates, err := m.score(ctx)
+		if err != nil {
+			return nil, err
+		}
+		m.candidates, m.cached = candidates, true
+	}
+	return m.candidates, nil
+}
+
+// score lists the candidate songs by descending score
+func (m *matcher) score(ctx context.Context) ([]Match, error) {
+	if m.recognizer.bits > 0 {
+		return m.bitErrorMatches(ctx)
+	}
+	if m.recognizer.melody != nil {
+		return m.melodyMatches(ctx)
+	}
+
+	model := m.recognizer.model
+	cfg := m.recognizer.fingerprinter.Config()
+
+	pitch := 0.0
+	if _, ok := m.recognizer.fingerprinter.(fingerprint.HashRescaler); ok {
+		pitch = 1
+	}
+
+	var speedMatches map[int64]*speedMatch
+	var factors []float64
+	if m.recognizer.opts.MaxSpeedDeviation > 0 {
+		var err error
+		if speedMatches, factors, err = m.searchSpeed(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	res := make([]Match, 0, len(m.offsetCounts))
+	for songID := range m.offsetCounts {
+		song, err := m.recognizer.catalog.Song(ctx, songID)
+		if errors.Is(err, catalog.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		score, offset := m.best(songID)
+		res = append(res, Match{
+			Song:       song,
+			Score:      score,
+			Hashes:     m.hashCounts[songID],
+			Confidence: model.confidence(score, m.queryHashes, m.queryFrames),
+			Offset:     cfg.FramesToSeconds(offset),
+			Speed:      1,
+			Pitch:      pitch,
+		})
+	}
+
+	// the speed search finds songs that share no hashes with the query at its own speed too
+	for songID, speedMatch := range speedMatches {
+		i := 0
+		for i < len(res) && res[i].Song.ID != songID {
+			i++
+		}
+
+		if i == len(res) {
+			song, err := m.recognizer.catalog.Song(ctx, songID)
+			if errors.Is(err, catalog.ErrNotFound) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			res = append(res, Match{Song: song})
+		}
+
+		res[i].Score = speedMatch.score
+		res[i].Hashes = max(res[i].Hashes, speedMatch.hits)
+		res[i].Confidence = model.searchedConfidence(speedMatch.score, m.queryHashes, m.queryFrames, len(factors), 2*alignmentWidth+1)
+		res[i].Offset = cfg.FrameSeconds() * speedMatch.offset
+		res[i].Speed = speedMatch.speed
+		res[i].Pitch = speedMatch.pitch
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Song.ID < res[j].Song.ID
+	})
+
+	return res, nil
+}
+
+// confident reports whether the top song is confident enough and its score is at least Margin times
+// the runner up's
+func (m *matcher) confident(ctx context.Context) (bool, error) {
+	if m.recognizer.bits > 0 || m.recognizer.melody != nil {
+		matches, err := m.cachedMatches(ctx)
+		if err != nil || len(matches) == 0 {
+			return false, err
+		}
+
+		second := 0
+		if len(matches) > 1 {
+			second = matches[1].Score
+		}
+		return matches[0].Confidence >= m.recognizer.opts.Threshold && float64(matches[0].Score) >= m.recognizer.opts.Margin*float64(second), nil
+	}
+
+	first, second := 0, 0
+	for songID := range m.offsetCounts {
+		score, _ := m.best(songID)
+		if score > first {
+			first, second = score, first
+		} else if score > second {
+			second = score
+		}
+	}
+
+	if first == 0 || float64(first) < m.recognizer.opts.Margin*float64(second) {
+		return false, nil
+	}
+
+	return m.recognizer.model.confidence(first, m.queryHashes, m.queryFrames) >= m.recognizer.opts.Threshold, nil
+}
@@ -0,0 +1,22 @@
+package recognizer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+)
+
+func TestHashToleranceNeedsPeakPairs(t *testing.T) {
+	opts := DefaultOptions
+	opts.HashTolerance = 1
+
+	// the low bits of these algorithms' hashes aren't a time delta
+	for algorithm, preset := range map[string]string{"quad": "default", "philips": "philips", "melody": "melody"} {
+		cfg, _ := fingerprint.Preset(preset)
+		if _, err := New(context.Background(), nil, algorithm, cfg, opts); !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: hash tolerance accepted, got error %v", algorithm, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package recognizer
+
+import (
+	"context"
+	"math"
+
+	"github.com/RobertMNewton/gozam/pkg/fingerprint"
+)
+
+const (
+	// speedStep is the spacing of the speed factors searched. A landmark's time delta and frequencies
+	// move by under half a frame or bin for steps this small.
+	speedStep = 0.005
+	// alignmentWidth is how many frames a hit can lie from the fitted alignment and still count
+	alignmentWidth = 1
+)
+
+// timePair is a hit of a query hash, the anchor time in the query and in the song, and the ratio of
+// the query's anchor frequency to the song's
+type timePair struct {
+	query, song int
+	freqRatio   float64
+}
+
+// speedMatch is the best alignment of the query with a song when searching speed factors. The song
+// time of a query frame is offset + speed*frame.
+type speedMatch struct {
+	factor float64
+	offset float64
+	speed  float64
+	pitch  float64
+	score  int
+	hits   int
+	pairs  []timePair
+}
+
+// speedFactors lists the speed factors within maxDeviation of 1, starting with 1 itself
+func speedFactors(maxDeviation float64) []float64 {
+	factors := []float64{1}
+	for i := 1; float64(i)*speedStep <= maxDeviation+1e-9; i++ {
+		factors = append(factors, 1+float64(i)*speedStep, 1-float64(i)*speedStep)
+	}
+	return factors
+}
+
+// searchSpeed scores each song at every speed factor within MaxSpeedDeviation, fitting a line
+// through the hits of its best factor to estimate the speed and rescoring the song along it
+func (m *matcher) searchSpeed(ctx context.Context) (map[int64]*speedMatch, []float64, error) {
+	factors := speedFactors(m.recognizer.opts.MaxSpeedDeviation)
+	rescaler, _ := m.recognizer.fingerprinter.(fingerprint.HashRescaler)
+
+	res := make(map[int64]*speedMatch)
+	for _, factor := range factors {
+		pairs := make(map[int64][]timePair)
+		for hash, queryTimes := range m.fingerprint.Hashes {
+			// hashes that don't change with speed only need their times rescaling, and give no
+			// estimate of the pitch
+			songHash, freqRatio := hash, 0.0
+			if rescaler != nil {
+				songHash, freqRatio = rescaler.RescaleHash(hash, factor)
+			}
+			hits, err := m.lookup(ctx, songHash)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			for _, hit := range hits {
+				for _, queryTime := range queryTimes {
+					pairs[hit.SongID] = append(pairs[hit.SongID], timePair{query: queryTime, song: hit.Time, freqRatio: freqRatio})
+				}
+			}
+		}
+
+		// keep the factor with the tallest offset bin, preferring those nearest 1 as they come first
+		for songID, songPairs := range pairs {
+			offsets := make(map[int]int)
+			bestOffset, bestScore := 0, 0
+			for _, pair := range songPairs {
+				offset := pair.song - int(math.Round(factor*float64(pair.query)))
+				offsets[offset]++
+				if offsets[offset] > bestScore || (offsets[offset] == bestScore && offset < bestOffset) {
+					bestOffset, bestScore = offset, offsets[offset]
+				}
+			}
+
+			if match, ok := res[songID]; !ok || bestScore > match.score {
+				res[songID] = &speedMatch{factor: factor, offset: float64(bestOffset), speed: factor, score: bestScore, pairs: songPairs}
+			}
+		}
+	}
+
+	for _, match := range res {
+		match.fit()
+	}
+
+	return res, factors, nil
+}
+
+// fit refines the alignment with a least squares line through the hits near it, then scores the
+// song by the hits near the refined line and estimates the pitch from their frequency ratios
+func (match *speedMatch) fit() {
+	var inliers []timePair
+	for _, pair := range match.pairs {
+		if math.Abs(float64(pair.song)-match.offset-match.speed*float64(pair.query)) <= alignmentWidth {
+			inliers = append(inliers, pair)
+		}
+	}
+
+	if len(inliers) > 1 {
+		var meanQuery, meanSong float64
+		for _, pair := range inliers {
+			meanQuery += float64(pair.query) / float64(len(inliers))
+			meanSong += float64(pair.song) / float64(len(inliers))
+		}
+
+		var covariance, variance float64
+		for _, pair := range inliers {
+			covariance += (float64(pair.query) - meanQuery) * (float64(pair.song) - meanSong)
+			variance += (float64(pair.query) - meanQuery) * (float64(pair.query) - meanQuery)
+		}
+
+		// a fit over a short stretch of the query can be wild, so only trust it near the factor
+		if speed := covariance / variance; variance > 0 && math.Abs(speed-match.factor) <= speedStep {
+			match.speed, match.offset = speed, meanSong-speed*meanQuery
+		} else {
+			match.offset = meanSong - match.speed*meanQuery
+		}
+	}
+
+	match.score, match.pitch = 0, 0
+	for _, pair := range match.pairs {
+		if math.Abs(float64(pair.song)-match.offset-match.speed*float64(pair.query)) <= alignmentWidth {
+			match.score++
+			match.pitch += pair.freqRatio
+		}
+	}
+
+	if match.score > 0 {
+		match.pitch /= float64(match.score)
+	}
+	match.hits, match.pairs = len(match.pairs), nil
+}